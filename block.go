@@ -2,57 +2,230 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
-	"encoding/gob"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"log"
-	"time"
 )
 
-// Block represents a block in the blockchain
-type Block struct {
+// Block header versions. Version 0 headers are those of legacy blocks: they
+// are hashed the way blocks were hashed before headers had a fixed layout, and
+// commit to the hash of the concatenated transaction hashes instead of a
+// Merkle root.
+const (
+	legacyHeaderVersion = 0
+	headerVersion       = 1
+)
+
+// blockHeaderLen is the size of the fixed layout a block header is hashed in
+const blockHeaderLen = 88
+
+// BlockHeader holds the hashed fields of a block, plus the resulting hash, the
+// height of the block and, for blocks sealed by an authority, the public key
+// of the signer and its signature of the hash. It's all that is kept of a
+// block once its transactions are pruned.
+type BlockHeader struct {
+	Version       int
 	Timestamp     int64
-	Transactions  []*Transaction
 	PrevBlockHash []byte
+	TxRoot        []byte
 	Hash          []byte
+	Bits          int
 	Nonce         int
+	Height        int
+	Signer        []byte
+	Signature     []byte
 }
 
-// NewBlock creates and returns Block
-func NewBlock(transactions []*Transaction, prevBlockHash []byte) *Block {
-	block := &Block{time.Now().Unix(), transactions, prevBlockHash, []byte{}, 0}
-	pow := NewProofOfWork(block)
-	nonce, hash := pow.Run()
+// Block represents a block in the blockchain
+type Block struct {
+	BlockHeader
+	Transactions []*Transaction
+}
+
+// NewBlock creates a Block of the transactions from a header prepared by
+// engine and seals it with engine. The transactions root is computed once,
+// before sealing starts. It fails when ctx is done before the block is sealed.
+func NewBlock(ctx context.Context, engine Engine, header BlockHeader, transactions []*Transaction) (*Block, error) {
+	block := &Block{header, transactions}
+	block.Version = headerVersion
+	block.TxRoot = block.HashTransactions()
 
-	block.Hash = hash[:]
-	block.Nonce = nonce
+	err := engine.Seal(ctx, &block.BlockHeader)
+	if err != nil {
+		return nil, err
+	}
 
-	return block
+	return block, nil
 }
 
-// NewGenesisBlock creates and returns genesis Block
-func NewGenesisBlock(coinbase *Transaction) *Block {
-	return NewBlock([]*Transaction{coinbase}, []byte{})
+// NewGenesisBlock creates and seals genesis Block stamped with timestamp
+func NewGenesisBlock(ctx context.Context, engine Engine, coinbase *Transaction, timestamp int64) (*Block, error) {
+	header := BlockHeader{Timestamp: timestamp, PrevBlockHash: []byte{}}
+
+	err := engine.Prepare(nil, &header, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBlock(ctx, engine, header, []*Transaction{coinbase})
 }
 
-// HashTransactions returns a hash of the transactions in the block
+// HashTransactions returns the transactions root of the block, the root of
+// the Merkle tree of its transaction hashes unless the block is a legacy one
 func (b *Block) HashTransactions() []byte {
+	txHashes := b.transactionHashes()
+
+	if b.Version == legacyHeaderVersion {
+		txHash := sha256.Sum256(bytes.Join(txHashes, []byte{}))
+
+		return txHash[:]
+	}
+
+	return NewMerkleTree(txHashes).Root()
+}
+
+func (b *Block) transactionHashes() [][]byte {
 	var txHashes [][]byte
-	var txHash [32]byte
 
 	for _, tx := range b.Transactions {
 		txHashes = append(txHashes, tx.Hash())
 	}
-	txHash = sha256.Sum256(bytes.Join(txHashes, []byte{}))
 
-	return txHash[:]
+	return txHashes
+}
+
+// Header returns a copy of the header of the block
+func (b *Block) Header() *BlockHeader {
+	header := b.BlockHeader
+
+	return &header
+}
+
+// computeHash returns the hash of the header for its current nonce
+func (h *BlockHeader) computeHash() []byte {
+	hash := sha256.Sum256(h.hashData(h.Nonce))
+
+	return hash[:]
+}
+
+// hashData returns the bytes hashed by the proof-of-work of the header for
+// the given nonce. Headers from version 1 on use the fixed layout described in
+// encoding.go. Both layouts end with the nonce as a big-endian int64.
+func (h *BlockHeader) hashData(nonce int) []byte {
+	if h.Version == legacyHeaderVersion {
+		return bytes.Join(
+			[][]byte{
+				h.PrevBlockHash,
+				h.TxRoot,
+				IntToHex(h.Timestamp),
+				IntToHex(int64(effectiveBits(h.Bits))),
+				IntToHex(int64(nonce)),
+			},
+			[]byte{},
+		)
+	}
+
+	data := make([]byte, blockHeaderLen)
+	binary.BigEndian.PutUint32(data[0:], uint32(h.Version))
+	copy(data[4:36], h.PrevBlockHash)
+	copy(data[36:68], h.TxRoot)
+	binary.BigEndian.PutUint64(data[68:], uint64(h.Timestamp))
+	binary.BigEndian.PutUint32(data[76:], uint32(h.Bits))
+	binary.BigEndian.PutUint64(data[80:], uint64(nonce))
+
+	return data
+}
+
+// blockLayout is the version of the binary layout of blocks and block headers
+const blockLayout = 1
+
+// encodeFields writes the header fields shared by the block and header layouts
+func (h *BlockHeader) encodeFields(e *encoder) {
+	e.uint32(uint32(h.Version))
+	e.int64(h.Timestamp)
+	e.bytes(h.PrevBlockHash)
+	e.bytes(h.TxRoot)
+	e.bytes(h.Hash)
+	e.uint32(uint32(h.Bits))
+	e.int64(int64(h.Nonce))
+	e.int64(int64(h.Height))
+	e.bytes(h.Signer)
+	e.bytes(h.Signature)
+}
+
+// decodeFields reads the header fields written by encodeFields
+func (h *BlockHeader) decodeFields(d *decoder) {
+	h.Version = int(d.uint32())
+	h.Timestamp = d.int64()
+	h.PrevBlockHash = d.bytes()
+	h.TxRoot = d.bytes()
+	h.Hash = d.bytes()
+	h.Bits = int(d.uint32())
+	h.Nonce = int(d.int64())
+	h.Height = int(d.int64())
+	h.Signer = d.bytes()
+	h.Signature = d.bytes()
+}
+
+// Encode writes the block in the binary layout described in encoding.go
+func (b *Block) Encode(w io.Writer) error {
+	e := &encoder{w: w}
+
+	e.uint32(blockLayout)
+	b.encodeFields(e)
+
+	e.count(len(b.Transactions))
+	if e.err != nil {
+		return e.err
+	}
+
+	for _, tx := range b.Transactions {
+		err := tx.Encode(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-// Serialize serializes the block
+// DecodeBlock reads a block written by Encode
+func DecodeBlock(r io.Reader) (*Block, error) {
+	d := &decoder{r: r}
+	block := Block{}
+
+	layout := d.uint32()
+	if d.err == nil && layout != blockLayout {
+		return nil, fmt.Errorf("unsupported block layout %d", layout)
+	}
+	block.decodeFields(d)
+
+	n := d.count()
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	for i := 0; i < n; i++ {
+		tx, err := DecodeTransaction(r)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %s", i, err)
+		}
+		block.Transactions = append(block.Transactions, tx)
+	}
+
+	return &block, nil
+}
+
+// Serialize serializes the block. Encoding to memory can't fail for a block
+// that fits in memory.
 func (b *Block) Serialize() []byte {
 	var result bytes.Buffer
-	encoder := gob.NewEncoder(&result)
 
-	err := encoder.Encode(b)
+	err := b.Encode(&result)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -61,14 +234,75 @@ func (b *Block) Serialize() []byte {
 }
 
 // DeserializeBlock deserializes a block
-func DeserializeBlock(d []byte) *Block {
-	var block Block
+func DeserializeBlock(d []byte) (*Block, error) {
+	var block *Block
 
-	decoder := gob.NewDecoder(bytes.NewReader(d))
-	err := decoder.Decode(&block)
+	err := decodeAll(d, func(r io.Reader) error {
+		var err error
+		block, err = DecodeBlock(r)
+
+		return err
+	})
+	if err != nil {
+		return nil, errors.New("invalid block: " + err.Error())
+	}
+
+	return block, nil
+}
+
+// Encode writes the block header in the binary layout described in encoding.go
+func (h *BlockHeader) Encode(w io.Writer) error {
+	e := &encoder{w: w}
+
+	e.uint32(blockLayout)
+	h.encodeFields(e)
+
+	return e.err
+}
+
+// DecodeBlockHeader reads a block header written by Encode
+func DecodeBlockHeader(r io.Reader) (*BlockHeader, error) {
+	d := &decoder{r: r}
+	header := BlockHeader{}
+
+	layout := d.uint32()
+	if d.err == nil && layout != blockLayout {
+		return nil, fmt.Errorf("unsupported block header layout %d", layout)
+	}
+	header.decodeFields(d)
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return &header, nil
+}
+
+// Serialize serializes the block header
+func (h *BlockHeader) Serialize() []byte {
+	var result bytes.Buffer
+
+	err := h.Encode(&result)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	return &block
+	return result.Bytes()
+}
+
+// DeserializeBlockHeader deserializes a block header
+func DeserializeBlockHeader(d []byte) (*BlockHeader, error) {
+	var header *BlockHeader
+
+	err := decodeAll(d, func(r io.Reader) error {
+		var err error
+		header, err = DecodeBlockHeader(r)
+
+		return err
+	})
+	if err != nil {
+		return nil, errors.New("invalid block header: " + err.Error())
+	}
+
+	return header, nil
 }
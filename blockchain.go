@@ -2,59 +2,148 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
 	"os"
-
-	"github.com/boltdb/bolt"
+	"time"
 )
 
 const dbFile = "blockchain.db"
 const blocksBucket = "blocks"
-const genesisCoinbaseData = "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks"
+
+// blocksFormatKey marks databases whose blocks use the binary layout. Those
+// without it were created before, see migrateLegacyChain.
+var blocksFormatKey = []byte("v")
+
+// errTemplateConnected rolls back the store transaction of connectTemplate
+var errTemplateConnected = errors.New("template connected")
 
 // Blockchain implements interactions with a DB
 type Blockchain struct {
-	tip []byte
-	db  *bolt.DB
+	tip    []byte
+	db     Store
+	engine Engine
+
+	// pruneDepth is the number of latest blocks whose bodies are kept, 0 keeps all blocks
+	pruneDepth int
+
+	// now returns the current time, time.Now when nil. Blocks with timestamps
+	// more than maxFutureDrift ahead of it are rejected.
+	now            func() time.Time
+	maxFutureDrift time.Duration
 }
 
-// CreateBlockchain creates a new blockchain DB
-func CreateBlockchain(address string) *Blockchain {
-	if dbExists() {
+// CreateBlockchain creates a new blockchain DB sealed by engine. It fails
+// when ctx is done before the genesis block is sealed.
+func CreateBlockchain(ctx context.Context, engine Engine, address, dbPath string) (*Blockchain, error) {
+	if dbExists(dbPath) {
 		fmt.Println("Blockchain already exists.")
 		os.Exit(1)
 	}
 
-	var tip []byte
+	db, err := OpenBoltStore(dbPath)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	bc, err := CreateBlockchainInStore(ctx, engine, db, address, nil)
+	if err != nil {
+		db.Close()
+		os.Remove(dbPath)
+
+		return nil, err
+	}
+
+	return bc, nil
+}
+
+// CreateBlockchainInStore writes a new blockchain sealed by engine with its
+// genesis block into an empty Store. now is the clock of the chain, time.Now
+// when nil, and stamps the genesis block. It fails when ctx is done before the
+// genesis block is sealed.
+func CreateBlockchainInStore(ctx context.Context, engine Engine, db Store, address string, now func() time.Time) (*Blockchain, error) {
+	timestamp := time.Now()
+	if now != nil {
+		timestamp = now()
+	}
 
-	cbtx := NewCoinbaseTX(address, genesisCoinbaseData)
-	genesis := NewGenesisBlock(cbtx)
+	cbtx := NewCoinbaseTX(address, activeParams.GenesisCoinbaseData, activeParams.Emission.Subsidy(0))
+	genesis, err := NewGenesisBlock(ctx, engine, cbtx, timestamp.Unix())
+	if err != nil {
+		return nil, err
+	}
 
-	db, err := bolt.Open(dbFile, 0600, nil)
+	bc, err := InitBlockchain(db, engine, genesis, now)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucket([]byte(blocksBucket))
+	return bc, nil
+}
+
+// InitBlockchain validates a genesis block of the active network sealed by
+// engine and writes it with the chain buckets into an empty Store. now is the
+// clock of the chain, time.Now when nil.
+func InitBlockchain(db Store, engine Engine, genesis *Block, now func() time.Time) (*Blockchain, error) {
+	bc := Blockchain{tip: genesis.Hash, db: db, engine: engine, now: now, maxFutureDrift: defaultMaxFutureDrift}
+
+	err := checkBlockTransactions(genesis)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(genesis.Transactions[0].CoinbaseData()) != activeParams.GenesisCoinbaseData {
+		return nil, fmt.Errorf("genesis block doesn't belong to %s", activeParams.Name)
+	}
+
+	err = db.Update(func(tx StoreTx) error {
+		err := bc.checkHeader(tx, genesis.Header(), nil)
+		if err != nil {
+			return err
+		}
+
+		for _, bucket := range []string{blocksBucket, utxoBucket, undoBucket, heightsBucket, chainworkBucket, mempoolBucket} {
+			err := tx.CreateBucket(bucket)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tx.Put(blocksBucket, blocksFormatKey, IntToHex(blockLayout))
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
 
-		err = b.Put(genesis.Hash, genesis.Serialize())
+		err = tx.PutBlock(genesis)
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
 
-		err = b.Put([]byte("l"), genesis.Hash)
+		err = tx.Put(chainworkBucket, genesis.Hash, engine.Work(genesis.Header()).Bytes())
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
-		tip = genesis.Hash
+
+		return connectBlock(tx, genesis)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &bc, nil
+}
+
+// HasBlockchain reports whether a Store already holds a blockchain
+func HasBlockchain(db Store) bool {
+	found := false
+
+	err := db.View(func(tx StoreTx) error {
+		found = len(tx.Tip()) > 0
 
 		return nil
 	})
@@ -62,27 +151,33 @@ func CreateBlockchain(address string) *Blockchain {
 		log.Panic(err)
 	}
 
-	bc := Blockchain{tip, db}
-
-	return &bc
+	return found
 }
 
-// NewBlockchain creates a new Blockchain with genesis Block
-func NewBlockchain(address string) *Blockchain {
-	if dbExists() == false {
+// NewBlockchain opens the Blockchain kept in the database at dbPath
+func NewBlockchain(dbPath string) *Blockchain {
+	if dbExists(dbPath) == false {
 		fmt.Println("No existing blockchain found. Create one first.")
 		os.Exit(1)
 	}
 
-	var tip []byte
-	db, err := bolt.Open(dbFile, 0600, nil)
+	db, err := OpenBoltStore(dbPath)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		tip = b.Get([]byte("l"))
+	return LoadBlockchain(db)
+}
+
+// LoadBlockchain returns the Blockchain kept in a Store. Its blocks are
+// checked by the proof-of-work engine until another one is set.
+func LoadBlockchain(db Store) *Blockchain {
+	var tip []byte
+	var hasFormat bool
+
+	err := db.View(func(tx StoreTx) error {
+		tip = tx.Tip()
+		hasFormat = tx.Get(blocksBucket, blocksFormatKey) != nil
 
 		return nil
 	})
@@ -90,60 +185,81 @@ func NewBlockchain(address string) *Blockchain {
 		log.Panic(err)
 	}
 
-	bc := Blockchain{tip, db}
+	bc := Blockchain{tip: tip, db: db, engine: NewProofOfWorkEngine(NewMiner(0)), maxFutureDrift: defaultMaxFutureDrift}
+
+	// Databases created before the binary layout are upgraded once
+	if !hasFormat {
+		bc.migrateLegacyChain()
+	}
 
 	return &bc
 }
 
-// FindSpendableOutputs finds and returns unspent outputs to reference in inputs
-func (bc *Blockchain) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
-	unspentOutputs := make(map[string][]int)
-	unspentTXs := bc.FindUnspentTransactions(pubKeyHash)
-	accumulated := 0
-
-Work:
-	for _, tx := range unspentTXs {
-		txID := hex.EncodeToString(tx.ID)
+// FindTransaction finds a transaction by its ID
+func (bc *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
+	var transaction Transaction
 
-		for outIdx, out := range tx.Vout {
-			if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
-				accumulated += out.Value
-				unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
+	err := bc.db.View(func(tx StoreTx) error {
+		var err error
+		transaction, err = findTransaction(tx, ID)
 
-				if accumulated >= amount {
-					break Work
-				}
-			}
-		}
-	}
+		return err
+	})
 
-	return accumulated, unspentOutputs
+	return transaction, err
 }
 
-// FindTransaction finds a transaction by its ID
-func (bc *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
-	bci := bc.Iterator()
+// LocateTransaction returns the block and position of a transaction. It uses
+// the transaction index when present and scans the chain otherwise.
+func (bc *Blockchain) LocateTransaction(ID []byte) (TxLocation, error) {
+	var loc TxLocation
 
-	for {
-		block := bci.Next()
+	err := bc.db.View(func(tx StoreTx) error {
+		var err error
+		loc, err = locateTransaction(tx, ID)
 
-		for _, tx := range block.Transactions {
-			if bytes.Compare(tx.ID, ID) == 0 {
-				return *tx, nil
-			}
-		}
+		return err
+	})
 
-		if len(block.PrevBlockHash) == 0 {
-			break
+	return loc, err
+}
+
+// GetBlock finds a block by its hash and returns it
+func (bc *Blockchain) GetBlock(blockHash []byte) (Block, error) {
+	var block Block
+
+	err := bc.db.View(func(tx StoreTx) error {
+		b, err := getFullBlock(tx, blockHash)
+		if err != nil {
+			return err
 		}
+		block = *b
+
+		return nil
+	})
+
+	return block, err
+}
+
+// Confirmations returns the number of blocks from the tip down to and
+// including the given block, or 0 if the block is not on the best chain
+func (bc *Blockchain) Confirmations(blockHash []byte) int {
+	block, err := bc.GetBlockHeader(blockHash)
+	if err != nil {
+		return 0
 	}
 
-	return Transaction{}, errors.New("Transaction is not found")
+	hash, err := bc.GetBlockHash(block.Height)
+	if err != nil || bytes.Compare(hash, blockHash) != 0 {
+		return 0
+	}
+
+	return bc.GetBestHeight() - block.Height + 1
 }
 
-// FindUnspentTransactions returns a list of transactions containing unspent outputs
-func (bc *Blockchain) FindUnspentTransactions(pubKeyHash []byte) []Transaction {
-	var unspentTXs []Transaction
+// ScanUTXO walks the whole chain and returns all unspent transaction outputs
+func (bc *Blockchain) ScanUTXO() map[string]TXOutputs {
+	UTXO := make(map[string]TXOutputs)
 	spentTXOs := make(map[string][]int)
 	bci := bc.Iterator()
 
@@ -164,17 +280,18 @@ func (bc *Blockchain) FindUnspentTransactions(pubKeyHash []byte) []Transaction {
 					}
 				}
 
-				if out.IsLockedWithKey(pubKeyHash) {
-					unspentTXs = append(unspentTXs, *tx)
+				outs, ok := UTXO[txID]
+				if !ok {
+					outs = TXOutputs{make(map[int]TXOutput), tx.IsCoinbase(), block.Height}
+					UTXO[txID] = outs
 				}
+				outs.Outputs[outIdx] = out
 			}
 
 			if tx.IsCoinbase() == false {
 				for _, in := range tx.Vin {
-					if in.UsesKey(pubKeyHash) {
-						inTxID := hex.EncodeToString(in.Txid)
-						spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Vout)
-					}
+					inTxID := hex.EncodeToString(in.Txid)
+					spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Vout)
 				}
 			}
 		}
@@ -184,23 +301,7 @@ func (bc *Blockchain) FindUnspentTransactions(pubKeyHash []byte) []Transaction {
 		}
 	}
 
-	return unspentTXs
-}
-
-// FindUTXO finds and returns all unspent transaction outputs
-func (bc *Blockchain) FindUTXO(pubKeyHash []byte) []TXOutput {
-	var UTXOs []TXOutput
-	unspentTransactions := bc.FindUnspentTransactions(pubKeyHash)
-
-	for _, tx := range unspentTransactions {
-		for _, out := range tx.Vout {
-			if out.IsLockedWithKey(pubKeyHash) {
-				UTXOs = append(UTXOs, out)
-			}
-		}
-	}
-
-	return UTXOs
+	return UTXO
 }
 
 // Iterator returns a BlockchainIterat
@@ -210,81 +311,125 @@ func (bc *Blockchain) Iterator() *BlockchainIterator {
 	return bci
 }
 
-// MineBlock mines a new block with the provided transactions
-func (bc *Blockchain) MineBlock(transactions []*Transaction) {
-	var lastHash []byte
+// MineBlock seals a new block with the provided transactions using the engine
+// of the chain and adds it to the chain. The block starts with a coinbase
+// paying the subsidy and the fees of the transactions to rewardTo. It fails
+// when a transaction is invalid, when ctx is done before the block is sealed
+// or when the chain rejects the block.
+func (bc *Blockchain) MineBlock(ctx context.Context, rewardTo string, transactions []*Transaction) (*Block, error) {
+	var header BlockHeader
+	var medianTime int64
+	var fees int
+
+	err := bc.db.View(func(tx StoreTx) error {
+		var err error
+		fees, err = newBlockFees(tx, transactions)
+		if err != nil {
+			return err
+		}
+
+		last := getHeader(tx, tx.Tip())
 
-	for _, tx := range transactions {
-		if bc.VerifyTransaction(tx) != true {
-			log.Panic("ERROR: Invalid transaction")
+		header.PrevBlockHash = last.Hash
+		header.Height = last.Height + 1
+		header.Timestamp = bc.currentTime().Unix()
+		medianTime = medianTimePast(tx, last)
+		if header.Timestamp <= medianTime {
+			header.Timestamp = medianTime + 1
 		}
+
+		return bc.engine.Prepare(tx, &header, last)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	err := bc.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		lastHash = b.Get([]byte("l"))
+	height := header.Height
+	data := fmt.Sprintf("Reward to '%s' at height %d", rewardTo, height)
+	cbtx := NewCoinbaseTX(rewardTo, data, activeParams.Emission.Subsidy(height)+fees)
+	transactions = append([]*Transaction{cbtx}, transactions...)
 
-		return nil
-	})
+	err = bc.connectTemplate(&Block{header, transactions}, medianTime)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
-	newBlock := NewBlock(transactions, lastHash)
+	newBlock, err := NewBlock(ctx, bc.engine, header, transactions)
+	if err != nil {
+		return nil, err
+	}
 
-	err = bc.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		err := b.Put(newBlock.Hash, newBlock.Serialize())
-		if err != nil {
-			log.Panic(err)
-		}
+	_, err = bc.AddBlock(newBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBlock, nil
+}
 
-		err = b.Put([]byte("l"), newBlock.Hash)
+// connectTemplate runs the checks AddBlock makes of the transactions of a
+// block, before it's sealed: the store transaction connecting it is always
+// rolled back
+func (bc *Blockchain) connectTemplate(block *Block, medianTime int64) error {
+	// The template has no hash yet, its undo data is keyed by a placeholder
+	block.Hash = make([]byte, sha256.Size)
+
+	err := bc.db.Update(func(tx StoreTx) error {
+		err := checkFinalTransactions(block, medianTime)
+		if err == nil {
+			err = UTXOSet{bc}.connect(tx, block)
+		}
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
 
-		bc.tip = newBlock.Hash
-
-		return nil
+		return errTemplateConnected
 	})
+	if err == errTemplateConnected {
+		return nil
+	}
+
+	return err
+}
+
+// TransactionFee returns the value of the outputs a transaction spends that
+// it doesn't pay to its own outputs
+func (bc *Blockchain) TransactionFee(tx *Transaction) int {
+	spent, err := UTXOSet{bc}.FindSpentOutputs(tx)
 	if err != nil {
 		log.Panic(err)
 	}
+
+	inValue := 0
+	for _, out := range spent {
+		inValue += out.Value
+	}
+
+	return inValue - tx.OutputValue()
 }
 
 // SignTransaction signs inputs of a Transaction
 func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) {
-	prevTXs := make(map[string]Transaction)
-
-	for _, vin := range tx.Vin {
-		prevTX, err := bc.FindTransaction(vin.Txid)
-		if err != nil {
-			log.Panic(err)
-		}
-		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+	spent, err := UTXOSet{bc}.FindSpentOutputs(tx)
+	if err != nil {
+		log.Panic(err)
 	}
 
-	tx.Sign(privKey, prevTXs)
+	tx.Sign(privKey, prevTXsFromOutputs(tx, spent))
 }
 
 // VerifyTransaction verifies transaction input signatures
 func (bc *Blockchain) VerifyTransaction(tx *Transaction) bool {
-	prevTXs := make(map[string]Transaction)
-
-	for _, vin := range tx.Vin {
-		prevTX, err := bc.FindTransaction(vin.Txid)
-		if err != nil {
-			log.Panic(err)
-		}
-		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+	spent, err := UTXOSet{bc}.FindSpentOutputs(tx)
+	if err != nil {
+		log.Panic(err)
 	}
 
-	return tx.Verify(prevTXs)
+	return tx.Verify(prevTXsFromOutputs(tx, spent))
 }
 
-func dbExists() bool {
-	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
+func dbExists(dbPath string) bool {
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
 		return false
 	}
 
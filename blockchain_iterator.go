@@ -1,27 +1,22 @@
 package main
 
-import (
-	"log"
-
-	"github.com/boltdb/bolt"
-)
+import "log"
 
 // BlockchainIterator is used to iterate over blockchain blocks
 type BlockchainIterator struct {
 	currentHash []byte
-	db          *bolt.DB
+	db          Store
 }
 
 // Next returns next block starting from the tip
 func (i *BlockchainIterator) Next() *Block {
 	var block *Block
 
-	err := i.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		encodedBlock := b.Get(i.currentHash)
-		block = DeserializeBlock(encodedBlock)
+	err := i.db.View(func(tx StoreTx) error {
+		var err error
+		block, err = getFullBlock(tx, i.currentHash)
 
-		return nil
+		return err
 	})
 
 	if err != nil {
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math/big"
+)
+
+const chainworkBucket = "chainwork"
+
+// AddBlock stores a block and makes it the new tip when its branch carries
+// more cumulative work than the best chain. Blocks of weaker branches are kept
+// as side branches. It returns the number of blocks disconnected from the best
+// chain by a reorganization. The transactions of disconnected blocks go back
+// to the mempool, those invalid on the new best chain are dropped.
+func (bc *Blockchain) AddBlock(block *Block) (int, error) {
+	var disconnected []*Block
+	var newTip []byte
+
+	err := bc.db.Update(func(tx StoreTx) error {
+		if getHeader(tx, block.Hash) != nil {
+			return nil
+		}
+
+		parent := getHeader(tx, block.PrevBlockHash)
+		if parent == nil {
+			return fmt.Errorf("previous block %x is not found", block.PrevBlockHash)
+		}
+
+		header := block.Header()
+		err := bc.checkHeader(tx, header, parent)
+		if err != nil {
+			return err
+		}
+
+		err = checkBlockTransactions(block)
+		if err != nil {
+			return err
+		}
+
+		err = checkFinalTransactions(block, medianTimePast(tx, parent))
+		if err != nil {
+			return err
+		}
+
+		work := new(big.Int).SetBytes(tx.Get(chainworkBucket, parent.Hash))
+		work.Add(work, bc.engine.Work(header))
+
+		err = tx.PutBlock(block)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Put(chainworkBucket, block.Hash, work.Bytes())
+		if err != nil {
+			return err
+		}
+
+		tipWork := new(big.Int).SetBytes(tx.Get(chainworkBucket, tx.Tip()))
+		if work.Cmp(tipWork) <= 0 {
+			return nil
+		}
+
+		disconnected, err = bc.reorganize(tx, block)
+		if err != nil {
+			return err
+		}
+		newTip = block.Hash
+
+		if bc.pruneDepth > 0 {
+			return pruneBlocks(tx, bc.pruneDepth)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// The tip only moves once the store transaction is committed, a failed
+	// one leaves the best chain as it was
+	if newTip != nil {
+		bc.tip = newTip
+	}
+
+	depth := len(disconnected)
+	if depth > 0 {
+		fmt.Printf("Chain reorganization: %d blocks disconnected, new tip %x\n", depth, block.Hash)
+		bc.restoreTransactions(disconnected)
+	}
+
+	return depth, nil
+}
+
+// restoreTransactions adds the transactions of blocks disconnected from the
+// best chain back to the mempool. They are added from the oldest block up, so
+// a transaction spending outputs of another disconnected one comes after it.
+// Transactions the new best chain includes or conflicts with fail validation
+// and are dropped, as are the ones spending outputs of dropped transactions or
+// of disconnected coinbases.
+func (bc *Blockchain) restoreTransactions(disconnected []*Block) {
+	mempool := Mempool{bc}
+	restored, dropped := 0, 0
+	for i := len(disconnected) - 1; i >= 0; i-- {
+		for _, tx := range disconnected[i].Transactions {
+			if tx.IsCoinbase() {
+				continue
+			}
+
+			if mempool.Add(tx) != nil {
+				dropped++
+				continue
+			}
+			restored++
+		}
+	}
+
+	if restored+dropped > 0 {
+		fmt.Printf("%d transactions returned to the mempool, %d dropped\n", restored, dropped)
+	}
+}
+
+// GetChainwork returns the cumulative proof-of-work of the chain ending with the block
+func (bc *Blockchain) GetChainwork(blockHash []byte) *big.Int {
+	work := new(big.Int)
+
+	err := bc.db.View(func(tx StoreTx) error {
+		work.SetBytes(tx.Get(chainworkBucket, blockHash))
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return work
+}
+
+// reorganize switches the best chain to the branch ending with newTip. Blocks
+// above the fork point are disconnected from the old tip down, then the new
+// branch is connected from the fork point up. Side branch blocks are never
+// pruned, but the fork point can be, and blocks below the pruned height can't
+// be disconnected. It returns the disconnected blocks, the old tip first. The
+// caller moves bc.tip once the store transaction commits.
+func (bc *Blockchain) reorganize(tx StoreTx, newTip *Block) ([]*Block, error) {
+	var branch []*Block
+	fork := newTip.Header()
+	for !isOnBestChain(tx, fork) {
+		branch = append(branch, tx.GetBlock(fork.Hash))
+		fork = getHeader(tx, fork.PrevBlockHash)
+	}
+
+	var disconnected []*Block
+	tip := tx.GetBlock(tx.Tip())
+	for bytes.Compare(tip.Hash, fork.Hash) != 0 {
+		err := disconnectBlock(tx, tip)
+		if err != nil {
+			return nil, err
+		}
+		disconnected = append(disconnected, tip)
+
+		tip = tx.GetBlock(tip.PrevBlockHash)
+		if tip == nil {
+			return nil, fmt.Errorf("can't reorganize below the pruned height %d", prunedHeight(tx))
+		}
+	}
+
+	for i := len(branch) - 1; i >= 0; i-- {
+		err := connectBlock(tx, branch[i])
+		if err != nil {
+			return nil, fmt.Errorf("block %x: %s", branch[i].Hash, err)
+		}
+	}
+
+	return disconnected, nil
+}
+
+// connectBlock makes a stored block the new tip of the best chain and updates
+// the derived state: height and transaction indexes, UTXO set and undo data.
+// The UTXO set update also checks the input signatures. Pending transactions
+// the block includes or conflicts with leave the mempool.
+func connectBlock(tx StoreTx, block *Block) error {
+	err := tx.SetTip(block.Hash)
+	if err != nil {
+		return err
+	}
+
+	err = indexHeight(tx, block)
+	if err != nil {
+		return err
+	}
+
+	err = indexTransactions(tx, block)
+	if err != nil {
+		return err
+	}
+
+	err = UTXOSet{}.connect(tx, block)
+	if err != nil {
+		return err
+	}
+
+	return removeFromMempool(tx, block)
+}
+
+// disconnectBlock removes the tip block from the best chain and reverts the
+// derived state. The block itself stays stored as a side branch block.
+func disconnectBlock(tx StoreTx, block *Block) error {
+	err := UTXOSet{}.disconnect(tx, block)
+	if err != nil {
+		return err
+	}
+
+	err = unindexTransactions(tx, block)
+	if err != nil {
+		return err
+	}
+
+	err = unindexHeight(tx, block)
+	if err != nil {
+		return err
+	}
+
+	return tx.SetTip(block.PrevBlockHash)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestConnectDisconnectBlock(t *testing.T) {
+	alice, bob := NewWallet(), NewWallet()
+	bc := newTestBlockchain(t, string(alice.GetAddress()))
+	bc.ReindexTransactions()
+	genesis := tipBlock(t, bc)
+	before := chainState(t, bc)
+
+	payment := NewUTXOTransaction(alice, string(bob.GetAddress()), 4, 1, 0, &UTXOSet{bc})
+	block := mineBlock(t, bc, string(alice.GetAddress()), payment)
+	after := chainState(t, bc)
+
+	err := bc.db.Update(func(tx StoreTx) error {
+		if tx.Get(undoBucket, block.Hash) == nil {
+			t.Error("connected block has no undo data")
+		}
+
+		return disconnectBlock(tx, block)
+	})
+	if err != nil {
+		t.Fatalf("disconnecting the block: %s", err)
+	}
+	compareStates(t, "after disconnecting", chainState(t, bc), before)
+	if got := chainState(t, bc)["tip"]; got != string(genesis.Hash) {
+		t.Errorf("tip is %x, want the genesis block %x", got, genesis.Hash)
+	}
+
+	err = bc.db.Update(func(tx StoreTx) error {
+		return connectBlock(tx, block)
+	})
+	if err != nil {
+		t.Fatalf("reconnecting the block: %s", err)
+	}
+	compareStates(t, "after reconnecting", chainState(t, bc), after)
+}
+
+func TestReorganize(t *testing.T) {
+	alice, bob, carol := NewWallet(), NewWallet(), NewWallet()
+	bc := newTestBlockchain(t, string(alice.GetAddress()))
+	genesis := tipBlock(t, bc)
+
+	payment := NewUTXOTransaction(alice, string(bob.GetAddress()), 4, 0, 0, &UTXOSet{bc})
+	main1 := mineBlock(t, bc, string(alice.GetAddress()), payment)
+
+	side1 := sealBlock(t, bc, genesis, string(carol.GetAddress()))
+	depth, err := bc.AddBlock(side1)
+	if err != nil || depth != 0 {
+		t.Fatalf("adding a side block of equal work: depth %d, %v", depth, err)
+	}
+	if !bytes.Equal(bc.tip, main1.Hash) {
+		t.Fatalf("a branch of equal work became the best chain")
+	}
+
+	side2 := sealBlock(t, bc, side1, string(carol.GetAddress()))
+	depth, err = bc.AddBlock(side2)
+	if err != nil || depth != 1 {
+		t.Fatalf("reorganizing to the side branch: depth %d, %v", depth, err)
+	}
+	if !bytes.Equal(bc.tip, side2.Hash) || bc.GetBestHeight() != 2 {
+		t.Fatalf("tip is %x at height %d, want %x at height 2", bc.tip, bc.GetBestHeight(), side2.Hash)
+	}
+	if got := balanceOf(bc, bob); got != 0 {
+		t.Errorf("bob has %d after the payment was disconnected, want 0", got)
+	}
+	if got := balanceOf(bc, carol); got != 20 {
+		t.Errorf("carol has %d, want 20", got)
+	}
+
+	entries := Mempool{bc}.Entries()
+	if len(entries) != 1 || !bytes.Equal(entries[0].Transaction.ID, payment.ID) {
+		t.Errorf("mempool holds %d transactions, want the disconnected payment", len(entries))
+	}
+
+	state := chainState(t, bc)
+	UTXOSet{bc}.Reindex()
+	compareStates(t, "reindexed UTXO set", chainState(t, bc), state)
+
+	main2 := sealBlock(t, bc, main1, string(alice.GetAddress()))
+	main3 := sealBlock(t, bc, main2, string(alice.GetAddress()))
+	for _, block := range []*Block{main2, main3} {
+		depth, err = bc.AddBlock(block)
+		if err != nil {
+			t.Fatalf("adding block %d of the old branch: %s", block.Height, err)
+		}
+	}
+	if depth != 2 || !bytes.Equal(bc.tip, main3.Hash) {
+		t.Fatalf("reorganizing back: depth %d, tip %x, want depth 2 and %x", depth, bc.tip, main3.Hash)
+	}
+	if got := balanceOf(bc, bob); got != 4 {
+		t.Errorf("bob has %d after the payment was reconnected, want 4", got)
+	}
+	if entries := (Mempool{bc}).Entries(); len(entries) != 0 {
+		t.Errorf("mempool holds %d transactions, want the reconnected payment removed", len(entries))
+	}
+}
+
+func TestReorganizeRestoresChainedTransactions(t *testing.T) {
+	alice, bob, carol := NewWallet(), NewWallet(), NewWallet()
+	bc := newTestBlockchain(t, string(alice.GetAddress()))
+	genesis := tipBlock(t, bc)
+
+	parent := NewUTXOTransaction(alice, string(bob.GetAddress()), 4, 1, 0, &UTXOSet{bc})
+	mineBlock(t, bc, string(alice.GetAddress()), parent)
+	child := NewUTXOTransaction(bob, string(carol.GetAddress()), 2, 1, 0, &UTXOSet{bc})
+	mineBlock(t, bc, string(alice.GetAddress()), child)
+
+	side := genesis
+	for i := 0; i < 3; i++ {
+		side = sealBlock(t, bc, side, string(alice.GetAddress()))
+		if _, err := bc.AddBlock(side); err != nil {
+			t.Fatalf("adding side block %d: %s", side.Height, err)
+		}
+	}
+	if !bytes.Equal(bc.tip, side.Hash) {
+		t.Fatalf("tip is %x, want the side branch %x", bc.tip, side.Hash)
+	}
+
+	transactions := Mempool{bc}.Transactions()
+	if len(transactions) != 2 || !bytes.Equal(transactions[0].ID, parent.ID) || !bytes.Equal(transactions[1].ID, child.ID) {
+		t.Fatalf("mempool offers %d transactions, want the parent then the child", len(transactions))
+	}
+
+	block := mineBlock(t, bc, string(alice.GetAddress()), transactions...)
+	if got := block.Transactions[0].OutputValue(); got != 10+2 {
+		t.Errorf("coinbase pays %d, want the subsidy and both fees", got)
+	}
+	if got := balanceOf(bc, carol); got != 2 {
+		t.Errorf("carol has %d, want the payment of the child", got)
+	}
+	if entries := (Mempool{bc}).Entries(); len(entries) != 0 {
+		t.Errorf("mempool holds %d transactions, want both mined", len(entries))
+	}
+}
+
+func TestFailedReorganizationRollsBack(t *testing.T) {
+	alice, bob := NewWallet(), NewWallet()
+	bc := newTestBlockchain(t, string(alice.GetAddress()))
+	genesis := tipBlock(t, bc)
+
+	payment := NewUTXOTransaction(alice, string(bob.GetAddress()), 4, 0, 0, &UTXOSet{bc})
+	main1 := mineBlock(t, bc, string(alice.GetAddress()))
+
+	side1 := sealBlock(t, bc, genesis, string(bob.GetAddress()), payment)
+	if _, err := bc.AddBlock(side1); err != nil {
+		t.Fatalf("adding a side block: %s", err)
+	}
+	before := chainState(t, bc)
+
+	// The second block spends the output the first one already spent, the
+	// reorganization fails once the first block is connected
+	side2 := sealBlock(t, bc, side1, string(bob.GetAddress()), payment)
+	if _, err := bc.AddBlock(side2); err == nil {
+		t.Fatal("a branch spending an output twice became the best chain")
+	}
+
+	if !bytes.Equal(bc.tip, main1.Hash) {
+		t.Errorf("tip moved to %x, want %x", bc.tip, main1.Hash)
+	}
+	compareStates(t, "after the failed reorganization", chainState(t, bc), before)
+	if _, err := bc.GetBlockHeader(side2.Hash); err == nil {
+		t.Error("the rejected block is stored")
+	}
+}
+
+func TestDuplicateTransactionRejected(t *testing.T) {
+	alice, carol := NewWallet(), NewWallet()
+	bc := newTestBlockchain(t, string(alice.GetAddress()))
+	genesis := tipBlock(t, bc)
+	before := chainState(t, bc)
+
+	// The block reuses the genesis coinbase, which is still unspent. Were it
+	// connected, disconnecting it would delete alice's output.
+	duplicate := sealTransactions(t, bc, genesis, genesis.Transactions)
+	if _, err := bc.AddBlock(duplicate); err == nil {
+		t.Fatal("a block overwriting an unspent transaction became the best chain")
+	}
+	compareStates(t, "after the rejected block", chainState(t, bc), before)
+
+	side1 := sealBlock(t, bc, genesis, string(carol.GetAddress()))
+	side2 := sealBlock(t, bc, side1, string(carol.GetAddress()))
+	for _, block := range []*Block{side1, side2} {
+		if _, err := bc.AddBlock(block); err != nil {
+			t.Fatalf("adding block %d of the other branch: %s", block.Height, err)
+		}
+	}
+	if !bytes.Equal(bc.tip, side2.Hash) {
+		t.Fatalf("tip is %x, want %x", bc.tip, side2.Hash)
+	}
+	if got := balanceOf(bc, alice); got != 10 {
+		t.Errorf("alice has %d, want the 10 of the genesis coinbase", got)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// useTestParams runs a test on regtest, whose blocks take a few hashes to
+// mine, with coinbase outputs spendable from the next block on
+func useTestParams(t *testing.T) {
+	params := regtestParams
+	params.CoinbaseMaturity = 1
+
+	old := activeParams
+	activeParams = &params
+	t.Cleanup(func() { activeParams = old })
+}
+
+// newTestBlockchain creates a blockchain in a MemoryStore paying the genesis
+// reward to address
+func newTestBlockchain(t *testing.T, address string) *Blockchain {
+	t.Helper()
+	useTestParams(t)
+
+	bc, err := CreateBlockchainInStore(context.Background(), NewProofOfWorkEngine(NewMiner(1)), NewMemoryStore(), address, nil)
+	if err != nil {
+		t.Fatalf("creating the blockchain: %s", err)
+	}
+	t.Cleanup(func() { bc.db.Close() })
+
+	return bc
+}
+
+// mineBlock mines a block with the transactions on top of the best chain
+func mineBlock(t *testing.T, bc *Blockchain, rewardTo string, transactions ...*Transaction) *Block {
+	t.Helper()
+
+	block, err := bc.MineBlock(context.Background(), rewardTo, transactions)
+	if err != nil {
+		t.Fatalf("mining a block: %s", err)
+	}
+
+	return block
+}
+
+// sealBlock seals a block with the transactions on top of parent without
+// adding it to the chain. Its coinbase pays the subsidy only.
+func sealBlock(t *testing.T, bc *Blockchain, parent *Block, rewardTo string, transactions ...*Transaction) *Block {
+	t.Helper()
+
+	height := parent.Height + 1
+	data := fmt.Sprintf("Test reward at height %d on %x", height, parent.Hash)
+	coinbase := NewCoinbaseTX(rewardTo, data, activeParams.Emission.Subsidy(height))
+
+	return sealTransactions(t, bc, parent, append([]*Transaction{coinbase}, transactions...))
+}
+
+// sealTransactions seals a block of exactly the transactions, coinbase
+// included, on top of parent without adding it to the chain
+func sealTransactions(t *testing.T, bc *Blockchain, parent *Block, transactions []*Transaction) *Block {
+	t.Helper()
+
+	header := BlockHeader{PrevBlockHash: parent.Hash, Height: parent.Height + 1, Timestamp: parent.Timestamp + 1}
+	err := bc.db.View(func(tx StoreTx) error {
+		return bc.engine.Prepare(tx, &header, parent.Header())
+	})
+	if err != nil {
+		t.Fatalf("preparing block %d: %s", header.Height, err)
+	}
+
+	block, err := NewBlock(context.Background(), bc.engine, header, transactions)
+	if err != nil {
+		t.Fatalf("sealing block %d: %s", header.Height, err)
+	}
+
+	return block
+}
+
+// tipBlock returns the block at the tip of the best chain
+func tipBlock(t *testing.T, bc *Blockchain) *Block {
+	t.Helper()
+
+	block, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatalf("reading the tip: %s", err)
+	}
+
+	return &block
+}
+
+// balanceOf returns the mature and immature outputs value of a wallet
+func balanceOf(bc *Blockchain, wallet *Wallet) int {
+	mature, immature := UTXOSet{bc}.Balance(NewP2PKHScript(HashPubKey(wallet.PublicKey)))
+
+	return mature + immature
+}
+
+// chainState returns a copy of the tip and of the state derived from the best
+// chain: the UTXO set and the height and transaction indexes. UTXO set entries
+// are decoded, as the encoding of their outputs map isn't deterministic.
+func chainState(t *testing.T, bc *Blockchain) map[string]string {
+	t.Helper()
+
+	state := make(map[string]string)
+	err := bc.db.View(func(tx StoreTx) error {
+		state["tip"] = string(tx.Tip())
+
+		for _, bucket := range []string{utxoBucket, heightsBucket, txIndexBucket} {
+			if !tx.HasBucket(bucket) {
+				continue
+			}
+
+			err := tx.ForEach(bucket, func(k, v []byte) error {
+				if bucket == utxoBucket {
+					state[fmt.Sprintf("%s/%x", bucket, k)] = fmt.Sprint(DeserializeOutputs(v))
+					return nil
+				}
+
+				state[fmt.Sprintf("%s/%x", bucket, k)] = string(v)
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("reading the chain state: %s", err)
+	}
+
+	return state
+}
+
+// compareStates reports the keys whose values differ between two chain states
+func compareStates(t *testing.T, what string, got, want map[string]string) {
+	t.Helper()
+
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: %s is %q, want %q", what, k, got[k], v)
+		}
+	}
+	for k := range got {
+		if _, ok := want[k]; !ok {
+			t.Errorf("%s: unexpected %s", what, k)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Levels of VerifyChain, each one includes the checks of the previous ones
+const (
+	verifyHeaders      = iota // previous block links, heights, seals and timestamps
+	verifyTransactions        // transaction IDs, roots, the coinbase position and lock times
+	verifyUTXO                // missing inputs, double spends, immature coinbase spends, value created from nothing and coinbase overpayment
+	verifySignatures          // input scripts and signatures
+)
+
+// VerifyChain replays the best chain from genesis and re-validates it up to
+// the given level. Only the depth most recent blocks are checked, older ones
+// just feed the replayed UTXO set; depth 0 checks every block. Pruned blocks
+// only have their headers checked, and as the replay needs every transaction,
+// levels from verifyUTXO up fail on a pruned chain. It returns the first
+// violation found.
+func (bc *Blockchain) VerifyChain(depth, level int) error {
+	bestHeight := bc.GetBestHeight()
+
+	checkFrom := 0
+	if depth > 0 && depth <= bestHeight {
+		checkFrom = bestHeight - depth + 1
+	}
+
+	return bc.db.View(func(tx StoreTx) error {
+		pruned := prunedHeight(tx)
+		if pruned > 0 && level >= verifyUTXO {
+			return fmt.Errorf("blocks below height %d are pruned, level %d needs every block", pruned, level)
+		}
+
+		UTXO := make(map[string]TXOutputs)
+		var parent *BlockHeader
+
+		for height := 0; height <= bestHeight; height++ {
+			hash := tx.Get(heightsBucket, IntToHex(int64(height)))
+			if hash == nil {
+				return fmt.Errorf("block at height %d is missing from the height index", height)
+			}
+
+			header := getHeader(tx, hash)
+			if header == nil {
+				return fmt.Errorf("block %d %x is missing", height, hash)
+			}
+
+			var block *Block
+			var err error
+			if height >= pruned {
+				block, err = getFullBlock(tx, hash)
+				if err == nil {
+					header = block.Header()
+				}
+			}
+			if err == nil && height >= checkFrom {
+				err = bc.checkHeader(tx, header, parent)
+			}
+			if err == nil && block != nil {
+				err = verifyBlock(block, UTXO, level, height >= checkFrom)
+			}
+			if err == nil && block != nil && height >= checkFrom && level >= verifyTransactions {
+				err = checkFinalTransactions(block, medianTimePast(tx, parent))
+			}
+			if err != nil {
+				return fmt.Errorf("block %d %x is invalid: %s", height, header.Hash, err)
+			}
+
+			parent = header
+		}
+
+		if bytes.Compare(parent.Hash, tx.Tip()) != 0 {
+			return fmt.Errorf("tip %x is not the block at height %d", tx.Tip(), bestHeight)
+		}
+
+		if level >= verifyUTXO && depth == 0 {
+			return compareUTXO(tx, UTXO)
+		}
+
+		return nil
+	})
+}
+
+// verifyBlock checks a single block of the replay and applies it to the
+// replayed UTXO set
+func verifyBlock(block *Block, UTXO map[string]TXOutputs, level int, check bool) error {
+	if check && level >= verifyTransactions {
+		err := checkBlockTransactions(block)
+		if err != nil {
+			return err
+		}
+	}
+
+	if level < verifyUTXO {
+		return nil
+	}
+
+	fees := 0
+	for _, btx := range block.Transactions {
+		if btx.IsCoinbase() == false {
+			inValue := 0
+			var spent []TXOutput
+
+			for _, vin := range btx.Vin {
+				txID := hex.EncodeToString(vin.Txid)
+
+				out, ok := UTXO[txID].Outputs[vin.Vout]
+				if !ok {
+					return fmt.Errorf("transaction %x spends missing or already spent output %x:%d", btx.ID, vin.Txid, vin.Vout)
+				}
+				if !UTXO[txID].IsMature(block.Height) {
+					return fmt.Errorf("transaction %x spends the coinbase output %x:%d of height %d before it matures", btx.ID, vin.Txid, vin.Vout, UTXO[txID].Height)
+				}
+				spent = append(spent, out)
+				inValue += out.Value
+
+				delete(UTXO[txID].Outputs, vin.Vout)
+				if len(UTXO[txID].Outputs) == 0 {
+					delete(UTXO, txID)
+				}
+			}
+
+			outValue := btx.OutputValue()
+			if outValue > inValue {
+				return fmt.Errorf("transaction %x creates %d from inputs worth %d", btx.ID, outValue, inValue)
+			}
+			fees += inValue - outValue
+
+			if check && level >= verifySignatures {
+				err := checkTransactionSignatures(btx, spent)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		UTXO[hex.EncodeToString(btx.ID)] = NewTXOutputs(btx, block.Height)
+	}
+
+	if check {
+		return checkCoinbaseValue(block, fees)
+	}
+
+	return nil
+}
+
+// compareUTXO checks the stored UTXO set against the replayed one
+func compareUTXO(tx StoreTx, UTXO map[string]TXOutputs) error {
+	mismatch := errors.New("UTXO set doesn't match the chain, run reindexutxo")
+
+	if tx.KeyCount(utxoBucket) != len(UTXO) {
+		return mismatch
+	}
+
+	return tx.ForEach(utxoBucket, func(k, v []byte) error {
+		expected, ok := UTXO[hex.EncodeToString(k)]
+		if !ok {
+			return mismatch
+		}
+
+		outs := DeserializeOutputs(v)
+		if len(outs.Outputs) != len(expected.Outputs) || outs.Coinbase != expected.Coinbase || outs.Height != expected.Height {
+			return mismatch
+		}
+
+		for outIdx, out := range outs.Outputs {
+			want, ok := expected.Outputs[outIdx]
+			if !ok || want.Value != out.Value || bytes.Compare(want.ScriptPubKey, out.ScriptPubKey) != 0 {
+				return mismatch
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// An export stream starts with exportMagic, then the format version and the
+// number of legacy blocks the chain starts with as big-endian uint32s. Each
+// block follows as a record: the length of the serialized block as a big-endian
+// uint32, the serialized block and the first 4 bytes of its double SHA-256.
+const exportMagic = "BCEX"
+const exportVersion = 1
+const exportHeaderLen = len(exportMagic) + 8
+const exportChecksumLen = 4
+const maxExportRecordLen = 32 << 20
+
+// ChainWriter writes blocks in the export format
+type ChainWriter struct {
+	w *bufio.Writer
+}
+
+// NewChainWriter writes the export header of a chain starting with
+// legacyHeight legacy blocks to w and returns a ChainWriter
+func NewChainWriter(w io.Writer, legacyHeight int) (*ChainWriter, error) {
+	bw := bufio.NewWriter(w)
+
+	_, err := bw.WriteString(exportMagic)
+	if err != nil {
+		return nil, err
+	}
+
+	err = binary.Write(bw, binary.BigEndian, uint32(exportVersion))
+	if err != nil {
+		return nil, err
+	}
+
+	err = binary.Write(bw, binary.BigEndian, uint32(legacyHeight))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChainWriter{bw}, nil
+}
+
+// WriteBlock appends a block record
+func (cw *ChainWriter) WriteBlock(block *Block) error {
+	data := block.Serialize()
+
+	err := binary.Write(cw.w, binary.BigEndian, uint32(len(data)))
+	if err != nil {
+		return err
+	}
+
+	_, err = cw.w.Write(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = cw.w.Write(exportChecksum(data))
+
+	return err
+}
+
+// Flush writes any buffered data to the underlying writer
+func (cw *ChainWriter) Flush() error {
+	return cw.w.Flush()
+}
+
+// ChainReader reads blocks written by a ChainWriter
+type ChainReader struct {
+	r            *bufio.Reader
+	legacyHeight int
+}
+
+// NewChainReader reads and checks the export header from r and returns a ChainReader
+func NewChainReader(r io.Reader) (*ChainReader, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, exportHeaderLen)
+	_, err := io.ReadFull(br, header)
+	if err != nil || string(header[:len(exportMagic)]) != exportMagic {
+		return nil, errors.New("not a chain export file")
+	}
+
+	version := binary.BigEndian.Uint32(header[len(exportMagic):])
+	if version != exportVersion {
+		return nil, fmt.Errorf("unsupported export format version %d", version)
+	}
+	legacyHeight := binary.BigEndian.Uint32(header[len(exportMagic)+4:])
+
+	return &ChainReader{br, int(legacyHeight)}, nil
+}
+
+// ReadBlock reads the next block record. It returns io.EOF after the last record.
+func (cr *ChainReader) ReadBlock() (*Block, error) {
+	var length uint32
+
+	err := binary.Read(cr.r, binary.BigEndian, &length)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, errors.New("export file is truncated")
+	}
+	if length == 0 || length > maxExportRecordLen {
+		return nil, fmt.Errorf("invalid record length %d", length)
+	}
+
+	data := make([]byte, int(length)+exportChecksumLen)
+	_, err = io.ReadFull(cr.r, data)
+	if err != nil {
+		return nil, errors.New("export file is truncated")
+	}
+
+	checksum := data[length:]
+	data = data[:length]
+	if bytes.Compare(checksum, exportChecksum(data)) != 0 {
+		return nil, errors.New("record checksum doesn't match")
+	}
+
+	return DeserializeBlock(data)
+}
+
+func exportChecksum(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+
+	return second[:exportChecksumLen]
+}
+
+// ExportChain writes the blocks of the best chain from genesis to the tip and
+// returns the number of blocks written. The blocks are read in a single store
+// transaction, so the export is a consistent snapshot of the chain.
+func (bc *Blockchain) ExportChain(w io.Writer) (int, error) {
+	var cw *ChainWriter
+	count := 0
+
+	err := bc.db.View(func(tx StoreTx) error {
+		var err error
+		cw, err = NewChainWriter(w, legacyHeight(tx))
+		if err != nil {
+			return err
+		}
+
+		for height := 0; ; height++ {
+			hash := tx.Get(heightsBucket, IntToHex(int64(height)))
+			if hash == nil {
+				return nil
+			}
+
+			block, err := getFullBlock(tx, hash)
+			if err != nil {
+				return err
+			}
+
+			err = cw.WriteBlock(block)
+			if err != nil {
+				return err
+			}
+			count++
+		}
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, cw.Flush()
+}
+
+// ImportChain adds the blocks read from cr to the chain kept in db. An empty
+// db is initialized with the exported genesis block. Every new block goes
+// through AddBlock, which checks its proof-of-work, its link to the parent and,
+// when it's connected, the signatures and inputs of its transactions. Each
+// block is committed on its own and blocks already stored are skipped, so an
+// interrupted import resumes where it stopped when it's run again. An empty db
+// starts a chain sealed by engine, with the legacy blocks of the export. The chain is passed to configure before
+// blocks are added to it.
+func ImportChain(db Store, cr *ChainReader, engine Engine, configure func(*Blockchain)) (imported, skipped int, err error) {
+	var bc *Blockchain
+
+	for {
+		block, err := cr.ReadBlock()
+		if err == io.EOF {
+			return imported, skipped, nil
+		}
+		if err != nil {
+			return imported, skipped, fmt.Errorf("record %d: %s", imported+skipped, err)
+		}
+
+		if bc == nil && !HasBlockchain(db) {
+			if cr.legacyHeight > 0 {
+				err = db.Update(func(tx StoreTx) error {
+					return setLegacyHeight(tx, cr.legacyHeight)
+				})
+				if err != nil {
+					return imported, skipped, err
+				}
+			}
+
+			bc, err = InitBlockchain(db, engine, block, nil)
+			if err != nil {
+				return imported, skipped, fmt.Errorf("block %d %x is invalid: %s", block.Height, block.Hash, err)
+			}
+			configure(bc)
+			imported++
+
+			continue
+		}
+		if bc == nil {
+			bc = LoadBlockchain(db)
+			configure(bc)
+		}
+
+		if _, err := bc.GetBlockHeader(block.Hash); err == nil {
+			skipped++
+			continue
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			return imported, skipped, fmt.Errorf("genesis block %x doesn't belong to this chain", block.Hash)
+		}
+
+		_, err = bc.AddBlock(block)
+		if err != nil {
+			return imported, skipped, fmt.Errorf("block %d %x is invalid: %s", block.Height, block.Hash, err)
+		}
+		imported++
+
+		if imported%1000 == 0 {
+			fmt.Printf("Imported %d blocks\n", imported)
+		}
+	}
+}
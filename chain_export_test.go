@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// importChain imports an export stream into db
+func importChain(t *testing.T, db Store, data []byte) (int, int, error) {
+	t.Helper()
+
+	cr, err := NewChainReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("reading the export header: %s", err)
+	}
+
+	return ImportChain(db, cr, NewProofOfWorkEngine(NewMiner(1)), func(*Blockchain) {})
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	alice, bob := NewWallet(), NewWallet()
+	bc := newTestBlockchain(t, string(alice.GetAddress()))
+	mineBlock(t, bc, string(alice.GetAddress()))
+	payment := NewUTXOTransaction(alice, string(bob.GetAddress()), 4, 1, 0, &UTXOSet{bc})
+	mineBlock(t, bc, string(bob.GetAddress()), payment)
+	mineBlock(t, bc, string(alice.GetAddress()))
+
+	var buf bytes.Buffer
+	count, err := bc.ExportChain(&buf)
+	if err != nil || count != 4 {
+		t.Fatalf("exporting: %d blocks, %v", count, err)
+	}
+
+	db := NewMemoryStore()
+	defer db.Close()
+	imported, skipped, err := importChain(t, db, buf.Bytes())
+	if err != nil || imported != 4 || skipped != 0 {
+		t.Fatalf("importing: %d imported, %d skipped, %v", imported, skipped, err)
+	}
+
+	copied := LoadBlockchain(db)
+	compareStates(t, "imported chain", chainState(t, copied), chainState(t, bc))
+	if err := copied.VerifyChain(0, verifySignatures); err != nil {
+		t.Errorf("imported chain doesn't verify: %s", err)
+	}
+
+	imported, skipped, err = importChain(t, db, buf.Bytes())
+	if err != nil || imported != 0 || skipped != 4 {
+		t.Errorf("importing again: %d imported, %d skipped, %v", imported, skipped, err)
+	}
+}
+
+func TestImportResumes(t *testing.T) {
+	alice := NewWallet()
+	bc := newTestBlockchain(t, string(alice.GetAddress()))
+	for i := 0; i < 3; i++ {
+		mineBlock(t, bc, string(alice.GetAddress()))
+	}
+
+	var buf bytes.Buffer
+	if _, err := bc.ExportChain(&buf); err != nil {
+		t.Fatalf("exporting: %s", err)
+	}
+	data := buf.Bytes()
+
+	// An import interrupted in the middle of the third block record
+	cut := exportHeaderLen
+	for i := 0; i < 2; i++ {
+		cut += 4 + int(binary.BigEndian.Uint32(data[cut:])) + exportChecksumLen
+	}
+	cut += 10
+
+	db := NewMemoryStore()
+	defer db.Close()
+	imported, _, err := importChain(t, db, data[:cut])
+	if err == nil || imported != 2 {
+		t.Fatalf("importing a truncated export: %d imported, %v", imported, err)
+	}
+
+	imported, skipped, err := importChain(t, db, data)
+	if err != nil || imported != 2 || skipped != 2 {
+		t.Fatalf("resuming the import: %d imported, %d skipped, %v", imported, skipped, err)
+	}
+	compareStates(t, "resumed import", chainState(t, LoadBlockchain(db)), chainState(t, bc))
+}
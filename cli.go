@@ -1,23 +1,89 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"os/signal"
+	"strconv"
+	"time"
 )
 
 // CLI responsible for processing command line arguments
-type CLI struct{}
+type CLI struct {
+	config *Config
+}
 
 func (cli *CLI) printUsage() {
-	fmt.Println("Usage:")
+	fmt.Println("Usage: [-datadir DIR] [-network NET] [-wallet FILE] [-prune N] [-miners N] [-txindex] COMMAND")
+	fmt.Println("  -datadir DIR - Keep the blockchain, wallet and " + configFile + " in DIR, defaults to $" + dataDirEnv + " or the current directory")
+	fmt.Println("  -network NET - Run on mainnet, testnet or regtest, the last two keep their files in a subdirectory of DIR")
+	fmt.Println("  -wallet FILE - Use FILE as the wallet file instead of the one in the data directory")
+	fmt.Println("  -prune N - Keep the transactions of the N latest blocks only, older blocks keep their headers")
+	fmt.Println("  -miners N - Mine with N worker goroutines, defaults to one per CPU")
+	fmt.Println("  -txindex - Keep an index of the transactions by ID, built from the best chain when missing")
+	fmt.Println("Commands:")
 	fmt.Println("  createblockchain -address ADDRESS - Create a blockchain and send genesis block reward to ADDRESS")
+	fmt.Println("  createmultisig -m M -keys KEYS - Create the address of outputs spendable with the signatures of M of the comma-separated KEYS, addresses of the wallet file or public keys, and save it into the wallet file")
 	fmt.Println("  createwallet - Generates a new key-pair and saves it into the wallet file")
+	fmt.Println("  estimatefee [-blocks K] - Suggest a fee rate from the fees paid in the K latest blocks")
+	fmt.Println("  exportchain -out FILE - Write the blocks of the best chain to FILE")
+	fmt.Println("  generate [-n N] -address ADDRESS - Mine N blocks, the first with the pending transactions, paying their rewards to ADDRESS")
 	fmt.Println("  getbalance -address ADDRESS - Get balance of ADDRESS")
+	fmt.Println("  getbestblockhash - Print the hash of the latest block")
+	fmt.Println("  getblock -height HEIGHT | -hash HASH - Print the block at HEIGHT or with HASH")
+	fmt.Println("  getblockcount - Print the height of the latest block")
+	fmt.Println("  getmempool - Print the transactions waiting to be mined")
+	fmt.Println("  getmerkleproof -txid TXID [-out FILE] - Print or write to FILE the proof that TXID is included in its block")
+	fmt.Println("  getpubkey -address ADDRESS - Print the public key of ADDRESS from the wallet file, to share for createmultisig")
+	fmt.Println("  getsupply [-height HEIGHT] - Print the supply scheduled up to HEIGHT, defaults to the latest block, the circulating supply at HEIGHT and the maximum supply")
+	fmt.Println("  gettransaction -id TXID - Print the transaction TXID with its block and confirmations")
+	fmt.Println("  importchain -in FILE - Validate the blocks in FILE and add them to the blockchain")
 	fmt.Println("  listaddresses - Lists all addresses from the wallet file")
-	fmt.Println("  printchain - Print all the blocks of the blockchain")
-	fmt.Println("  send -from FROM -to TO -amount AMOUNT - Send AMOUNT of coins from FROM address to TO")
+	fmt.Println("  mine -address ADDRESS - Mine a block with the pending transactions paying its reward and their fees to ADDRESS")
+	fmt.Println("  printchain [-from FROM] [-to TO] - Print the blocks of the blockchain between heights FROM and TO")
+	fmt.Println("  reindextx [-drop] - Rebuild the transaction index from the best chain, or drop it")
+	fmt.Println("  reindexutxo - Rebuilds the UTXO set")
+	fmt.Println("  send -from FROM -to TO -amount AMOUNT [-fee FEE | -feerate RATE] [-locktime LOCKTIME] [-out FILE] - Send AMOUNT of coins from FROM address to TO paying FEE, or RATE per " + strconv.Itoa(feeRateUnit) + " bytes, and add it to the mempool. It can only be mined above height LOCKTIME, or once the median block time passes LOCKTIME if it's a Unix time, from " + strconv.Itoa(lockTimeThreshold) + " on. From a multisig address, the transaction is written to FILE until enough keys sign it")
+	fmt.Println("  signtransaction -in FILE - Add the signatures of the wallet file to the transaction in FILE, and add it to the mempool once fully signed")
+	fmt.Println("  verifychain [-depth DEPTH] [-level LEVEL] - Re-validate the DEPTH latest blocks (0 for all) at LEVEL 0-3")
+	fmt.Println("  verifymerkleproof -proof FILE - Check the transaction inclusion proof in FILE against its block header")
+}
+
+// miningContext returns a context cancelled by Ctrl-C, which aborts mining
+func (cli *CLI) miningContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// consensusEngine returns the engine set by the config. Blocks of a poa
+// chain are signed with the keys of the wallet.
+func (cli *CLI) consensusEngine() Engine {
+	if cli.config.Consensus == "poa" {
+		wallets, err := NewWallets(cli.config.WalletPath())
+		if err != nil && !os.IsNotExist(err) {
+			log.Panic(err)
+		}
+
+		return NewProofOfAuthorityEngine(cli.config.Authorities, wallets)
+	}
+
+	return NewProofOfWorkEngine(NewMiner(cli.config.Miners))
+}
+
+// configureBlockchain applies the settings of the config to bc
+func (cli *CLI) configureBlockchain(bc *Blockchain) {
+	bc.engine = cli.consensusEngine()
+	bc.pruneDepth = cli.config.Prune
+	bc.maxFutureDrift = time.Duration(cli.config.MaxFutureDrift) * time.Second
+
+	if cli.config.TxIndex && !bc.HasTxIndex() {
+		fmt.Println("Building the transaction index...")
+		count := bc.ReindexTransactions()
+		fmt.Printf("Indexed %d transactions.\n", count)
+	}
 }
 
 func (cli *CLI) validateArgs() {
@@ -31,47 +97,232 @@ func (cli *CLI) validateArgs() {
 func (cli *CLI) Run() {
 	cli.validateArgs()
 
+	globalCmd := flag.NewFlagSet("blockchain", flag.ExitOnError)
+	globalDataDir := globalCmd.String("datadir", "", "The data directory")
+	globalNetwork := globalCmd.String("network", mainnetParams.Name, "The network: mainnet, testnet or regtest")
+	globalWallet := globalCmd.String("wallet", "", "The wallet file")
+	globalPrune := globalCmd.Int("prune", -1, "Number of latest blocks to keep the transactions of, 0 keeps all")
+	globalMiners := globalCmd.Int("miners", -1, "Number of mining workers, 0 uses one per CPU")
+	globalTxIndex := globalCmd.Bool("txindex", false, "Keep an index of the transactions by ID")
+
+	err := globalCmd.Parse(os.Args[1:])
+	if err != nil {
+		log.Panic(err)
+	}
+
+	args := globalCmd.Args()
+	if len(args) < 1 {
+		cli.printUsage()
+		os.Exit(1)
+	}
+
+	params, ok := networks[*globalNetwork]
+	if !ok {
+		fmt.Printf("ERROR: Unknown network %q\n", *globalNetwork)
+		os.Exit(1)
+	}
+	activeParams = params
+
+	cli.config, err = LoadConfig(*globalDataDir, params)
+	if err != nil {
+		log.Panic(err)
+	}
+	if *globalWallet != "" {
+		cli.config.WalletFile = *globalWallet
+	}
+	if *globalPrune >= 0 {
+		cli.config.Prune = *globalPrune
+	}
+	if *globalMiners >= 0 {
+		cli.config.Miners = *globalMiners
+	}
+	globalCmd.Visit(func(f *flag.Flag) {
+		if f.Name == "txindex" {
+			cli.config.TxIndex = *globalTxIndex
+		}
+	})
+
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
+	createMultisigCmd := flag.NewFlagSet("createmultisig", flag.ExitOnError)
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
+	estimateFeeCmd := flag.NewFlagSet("estimatefee", flag.ExitOnError)
+	exportChainCmd := flag.NewFlagSet("exportchain", flag.ExitOnError)
+	generateCmd := flag.NewFlagSet("generate", flag.ExitOnError)
+	getMempoolCmd := flag.NewFlagSet("getmempool", flag.ExitOnError)
+	getMerkleProofCmd := flag.NewFlagSet("getmerkleproof", flag.ExitOnError)
+	getBestBlockHashCmd := flag.NewFlagSet("getbestblockhash", flag.ExitOnError)
+	getBlockCmd := flag.NewFlagSet("getblock", flag.ExitOnError)
+	getBlockCountCmd := flag.NewFlagSet("getblockcount", flag.ExitOnError)
+	getPubKeyCmd := flag.NewFlagSet("getpubkey", flag.ExitOnError)
+	getSupplyCmd := flag.NewFlagSet("getsupply", flag.ExitOnError)
+	getTransactionCmd := flag.NewFlagSet("gettransaction", flag.ExitOnError)
+	importChainCmd := flag.NewFlagSet("importchain", flag.ExitOnError)
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	mineCmd := flag.NewFlagSet("mine", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
+	signTransactionCmd := flag.NewFlagSet("signtransaction", flag.ExitOnError)
+	verifyChainCmd := flag.NewFlagSet("verifychain", flag.ExitOnError)
+	verifyMerkleProofCmd := flag.NewFlagSet("verifymerkleproof", flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
+	reindexTxCmd := flag.NewFlagSet("reindextx", flag.ExitOnError)
+	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
 
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send genesis block reward to")
+	createMultisigM := createMultisigCmd.Int("m", 0, "Number of signatures required")
+	createMultisigKeys := createMultisigCmd.String("keys", "", "Comma-separated addresses of the wallet file or public keys")
+	estimateFeeBlocks := estimateFeeCmd.Int("blocks", 6, "Number of latest blocks to look at")
+	exportChainOut := exportChainCmd.String("out", "", "The file to export the blockchain to")
+	generateN := generateCmd.Int("n", 1, "Number of blocks to mine")
+	generateAddress := generateCmd.String("address", "", "The address to send the block rewards to")
+	getMerkleProofTxID := getMerkleProofCmd.String("txid", "", "The ID of the transaction")
+	getMerkleProofOut := getMerkleProofCmd.String("out", "", "The file to write the proof to")
+	getBlockHeight := getBlockCmd.Int("height", -1, "The height of the block")
+	getBlockHash := getBlockCmd.String("hash", "", "The hash of the block")
+	getPubKeyAddress := getPubKeyCmd.String("address", "", "The address of the wallet file")
+	getSupplyHeight := getSupplyCmd.Int("height", -1, "The height of the block, defaults to the latest block")
+	getTransactionID := getTransactionCmd.String("id", "", "The ID of the transaction")
+	importChainIn := importChainCmd.String("in", "", "The file to import blocks from")
+	mineAddress := mineCmd.String("address", "", "The address to send the block reward and fees to")
+	printChainFrom := printChainCmd.Int("from", 0, "The height to print from")
+	printChainTo := printChainCmd.Int("to", -1, "The height to print to, defaults to the latest block")
+	reindexTxDrop := reindexTxCmd.Bool("drop", false, "Drop the index instead of rebuilding it")
 	sendFrom := sendCmd.String("from", "", "Source wallet address")
 	sendTo := sendCmd.String("to", "", "Destination wallet address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendFee := sendCmd.Int("fee", 0, "Fee to pay")
+	sendFeeRate := sendCmd.Int("feerate", 0, "Fee to pay per "+strconv.Itoa(feeRateUnit)+" bytes of the transaction")
+	sendLockTime := sendCmd.Int("locktime", 0, "Height, or Unix time from "+strconv.Itoa(lockTimeThreshold)+" on, the transaction can only be mined after")
+	sendOut := sendCmd.String("out", "", "The file to write a partially signed transaction to")
+	signTransactionIn := signTransactionCmd.String("in", "", "The file with the transaction")
+	verifyChainDepth := verifyChainCmd.Int("depth", 0, "Number of latest blocks to check, 0 for all")
+	verifyChainLevel := verifyChainCmd.Int("level", verifySignatures, "Thoroughness of the checks, from 0 to 3")
+	verifyMerkleProofFile := verifyMerkleProofCmd.String("proof", "", "The file with the proof")
 
-	switch os.Args[1] {
+	switch args[0] {
 	case "getbalance":
-		err := getBalanceCmd.Parse(os.Args[2:])
+		err := getBalanceCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "createblockchain":
-		err := createBlockchainCmd.Parse(os.Args[2:])
+		err := createBlockchainCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "createmultisig":
+		err := createMultisigCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "createwallet":
-		err := createWalletCmd.Parse(os.Args[2:])
+		err := createWalletCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "estimatefee":
+		err := estimateFeeCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "exportchain":
+		err := exportChainCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "generate":
+		err := generateCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getmempool":
+		err := getMempoolCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getmerkleproof":
+		err := getMerkleProofCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getbestblockhash":
+		err := getBestBlockHashCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getblock":
+		err := getBlockCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getblockcount":
+		err := getBlockCountCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getpubkey":
+		err := getPubKeyCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getsupply":
+		err := getSupplyCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "gettransaction":
+		err := getTransactionCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importchain":
+		err := importChainCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "listaddresses":
-		err := listAddressesCmd.Parse(os.Args[2:])
+		err := listAddressesCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "mine":
+		err := mineCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "printchain":
-		err := printChainCmd.Parse(os.Args[2:])
+		err := printChainCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "reindextx":
+		err := reindexTxCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "reindexutxo":
+		err := reindexUTXOCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "send":
-		err := sendCmd.Parse(os.Args[2:])
+		err := sendCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "signtransaction":
+		err := signTransactionCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "verifychain":
+		err := verifyChainCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "verifymerkleproof":
+		err := verifyMerkleProofCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
@@ -96,24 +347,156 @@ func (cli *CLI) Run() {
 		cli.createBlockchain(*createBlockchainAddress)
 	}
 
+	if createMultisigCmd.Parsed() {
+		if *createMultisigM <= 0 || *createMultisigKeys == "" {
+			createMultisigCmd.Usage()
+			os.Exit(1)
+		}
+		cli.createMultisig(*createMultisigM, *createMultisigKeys)
+	}
+
 	if createWalletCmd.Parsed() {
 		cli.createWallet()
 	}
 
+	if estimateFeeCmd.Parsed() {
+		if *estimateFeeBlocks <= 0 {
+			estimateFeeCmd.Usage()
+			os.Exit(1)
+		}
+		cli.estimateFee(*estimateFeeBlocks)
+	}
+
+	if exportChainCmd.Parsed() {
+		if *exportChainOut == "" {
+			exportChainCmd.Usage()
+			os.Exit(1)
+		}
+		cli.exportChain(*exportChainOut)
+	}
+
+	if generateCmd.Parsed() {
+		if *generateN <= 0 || *generateAddress == "" {
+			generateCmd.Usage()
+			os.Exit(1)
+		}
+		cli.generate(*generateN, *generateAddress)
+	}
+
+	if getMempoolCmd.Parsed() {
+		cli.getMempool()
+	}
+
+	if getMerkleProofCmd.Parsed() {
+		if *getMerkleProofTxID == "" {
+			getMerkleProofCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getMerkleProof(*getMerkleProofTxID, *getMerkleProofOut)
+	}
+
+	if getBestBlockHashCmd.Parsed() {
+		cli.getBestBlockHash()
+	}
+
+	if getBlockCmd.Parsed() {
+		if (*getBlockHeight < 0) == (*getBlockHash == "") {
+			getBlockCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getBlock(*getBlockHeight, *getBlockHash)
+	}
+
+	if getBlockCountCmd.Parsed() {
+		cli.getBlockCount()
+	}
+
+	if getPubKeyCmd.Parsed() {
+		if *getPubKeyAddress == "" {
+			getPubKeyCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getPubKey(*getPubKeyAddress)
+	}
+
+	if getSupplyCmd.Parsed() {
+		cli.getSupply(*getSupplyHeight)
+	}
+
+	if getTransactionCmd.Parsed() {
+		if *getTransactionID == "" {
+			getTransactionCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getTransaction(*getTransactionID)
+	}
+
+	if importChainCmd.Parsed() {
+		if *importChainIn == "" {
+			importChainCmd.Usage()
+			os.Exit(1)
+		}
+		cli.importChain(*importChainIn)
+	}
+
 	if listAddressesCmd.Parsed() {
 		cli.listAddresses()
 	}
 
+	if mineCmd.Parsed() {
+		if *mineAddress == "" {
+			mineCmd.Usage()
+			os.Exit(1)
+		}
+		cli.mine(*mineAddress)
+	}
+
 	if printChainCmd.Parsed() {
-		cli.printChain()
+		if *printChainFrom < 0 {
+			printChainCmd.Usage()
+			os.Exit(1)
+		}
+		cli.printChain(*printChainFrom, *printChainTo)
+	}
+
+	if reindexTxCmd.Parsed() {
+		cli.reindexTx(*reindexTxDrop)
+	}
+
+	if reindexUTXOCmd.Parsed() {
+		cli.reindexUTXO()
 	}
 
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 || *sendFee < 0 || *sendFeeRate < 0 || (*sendFee > 0 && *sendFeeRate > 0) || *sendLockTime < 0 || *sendLockTime > math.MaxUint32 {
 			sendCmd.Usage()
 			os.Exit(1)
 		}
 
-		cli.send(*sendFrom, *sendTo, *sendAmount)
+		cli.send(*sendFrom, *sendTo, *sendAmount, *sendFee, *sendFeeRate, *sendLockTime, *sendOut)
+	}
+
+	if signTransactionCmd.Parsed() {
+		if *signTransactionIn == "" {
+			signTransactionCmd.Usage()
+			os.Exit(1)
+		}
+		cli.signTransaction(*signTransactionIn)
+	}
+
+	if verifyChainCmd.Parsed() {
+		if *verifyChainDepth < 0 || *verifyChainLevel < verifyHeaders || *verifyChainLevel > verifySignatures {
+			verifyChainCmd.Usage()
+			os.Exit(1)
+		}
+		cli.verifyChain(*verifyChainDepth, *verifyChainLevel)
+	}
+
+	if verifyMerkleProofCmd.Parsed() {
+		if *verifyMerkleProofFile == "" {
+			verifyMerkleProofCmd.Usage()
+			os.Exit(1)
+		}
+		cli.verifyMerkleProof(*verifyMerkleProofFile)
 	}
 }
@@ -3,13 +3,23 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 )
 
 func (cli *CLI) createBlockchain(address string) {
 	if !ValidateAddress(address) {
 		log.Panic("ERROR: Address is not valid")
 	}
-	bc := CreateBlockchain(address)
+
+	ctx, cancel := cli.miningContext()
+	defer cancel()
+
+	bc, err := CreateBlockchain(ctx, cli.consensusEngine(), address, cli.config.DBPath())
+	if err != nil {
+		fmt.Printf("ERROR: Block was not sealed: %s\n", err)
+		os.Exit(1)
+	}
+	cli.configureBlockchain(bc)
 	bc.db.Close()
 	fmt.Println("Done!")
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+func (cli *CLI) createMultisig(m int, keys string) {
+	wallets, err := NewWallets(cli.config.WalletPath())
+	if err != nil && !os.IsNotExist(err) {
+		log.Panic(err)
+	}
+
+	var pubKeys [][]byte
+	seen := make(map[string]bool)
+
+	for _, key := range strings.Split(keys, ",") {
+		pubKey, ok := multisigKey(wallets, key)
+		if !ok {
+			fmt.Printf("ERROR: %s is not an address of the wallet file or a public key\n", key)
+			os.Exit(1)
+		}
+		if seen[string(pubKey)] {
+			fmt.Printf("ERROR: Key %s is given twice\n", key)
+			os.Exit(1)
+		}
+		seen[string(pubKey)] = true
+
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	if len(pubKeys) > maxMultisigKeys {
+		fmt.Printf("ERROR: %d keys given, at most %d are allowed\n", len(pubKeys), maxMultisigKeys)
+		os.Exit(1)
+	}
+	if m > len(pubKeys) {
+		fmt.Printf("ERROR: Can't require %d signatures of %d keys\n", m, len(pubKeys))
+		os.Exit(1)
+	}
+
+	redeemScript := NewMultisigScript(m, pubKeys)
+	if len(redeemScript) > maxElementSize {
+		fmt.Printf("ERROR: Redeem script is %d bytes long, more than %d\n", len(redeemScript), maxElementSize)
+		os.Exit(1)
+	}
+
+	address := wallets.AddScript(redeemScript)
+	wallets.SaveToFile(cli.config.WalletPath())
+
+	fmt.Printf("Your new %d-of-%d address: %s\n", m, len(pubKeys), address)
+	fmt.Printf("Redeem script: %s\n", DisassembleScript(redeemScript))
+}
+
+// multisigKey returns the public key of an address of the wallet file, or a
+// public key with fixed-width coordinates given in hex
+func multisigKey(wallets *Wallets, key string) ([]byte, bool) {
+	if wallet, ok := wallets.Wallets[key]; ok {
+		return wallet.PublicKey, true
+	}
+
+	pubKey, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, false
+	}
+
+	parsed, err := parsePubKey(pubKey)
+	if err != nil {
+		return nil, false
+	}
+
+	return pubKey, parsed.Curve.IsOnCurve(parsed.X, parsed.Y)
+}
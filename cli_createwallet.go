@@ -3,9 +3,9 @@ package main
 import "fmt"
 
 func (cli *CLI) createWallet() {
-	wallets, _ := NewWallets()
+	wallets, _ := NewWallets(cli.config.WalletPath())
 	address := wallets.CreateWallet()
-	wallets.SaveToFile()
+	wallets.SaveToFile(cli.config.WalletPath())
 
 	fmt.Printf("Your new address: %s\n", address)
 }
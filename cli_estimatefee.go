@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+func (cli *CLI) estimateFee(blocks int) {
+	bc := NewBlockchain(cli.config.DBPath())
+	defer bc.db.Close()
+
+	rate, samples := bc.EstimateFeeRate(blocks)
+	if samples == 0 {
+		fmt.Printf("No transactions in the last %d blocks to estimate a fee rate from\n", blocks)
+		return
+	}
+
+	fmt.Printf("Fee rate: %d per %d bytes, from %d transactions in the last %d blocks\n", rate, feeRateUnit, samples, blocks)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func (cli *CLI) exportChain(out string) {
+	bc := NewBlockchain(cli.config.DBPath())
+	defer bc.db.Close()
+
+	f, err := os.Create(out)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
+	}
+
+	count, err := bc.ExportChain(f)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(out)
+		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Exported %d blocks to %s\n", count, out)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+func (cli *CLI) generate(n int, address string) {
+	if !ValidateAddress(address) {
+		log.Panic("ERROR: Address is not valid")
+	}
+
+	bc := NewBlockchain(cli.config.DBPath())
+	cli.configureBlockchain(bc)
+	defer bc.db.Close()
+
+	ctx, cancel := cli.miningContext()
+	defer cancel()
+
+	for i := 0; i < n; i++ {
+		_, err := bc.MineBlock(ctx, address, Mempool{bc}.Transactions())
+		if err != nil {
+			fmt.Printf("Generated %d blocks\n", i)
+			fmt.Printf("ERROR: Block was not mined: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Generated %d blocks, best height: %d\n", n, bc.GetBestHeight())
+}
@@ -9,17 +9,13 @@ func (cli *CLI) getBalance(address string) {
 	if !ValidateAddress(address) {
 		log.Panic("ERROR: Address is not valid")
 	}
-	bc := NewBlockchain(address)
+	bc := NewBlockchain(cli.config.DBPath())
+	UTXOSet := UTXOSet{bc}
 	defer bc.db.Close()
 
-	balance := 0
-	pubKeyHash := Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	UTXOs := bc.FindUTXO(pubKeyHash)
+	mature, immature := UTXOSet.Balance(AddressScript(address))
 
-	for _, out := range UTXOs {
-		balance += out.Value
-	}
-
-	fmt.Printf("Balance of '%s': %d\n", address, balance)
+	fmt.Printf("Balance of '%s': %d\n", address, mature+immature)
+	fmt.Printf("  Mature:   %d\n", mature)
+	fmt.Printf("  Immature: %d\n", immature)
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+func (cli *CLI) getBlock(height int, blockHash string) {
+	bc := NewBlockchain(cli.config.DBPath())
+	defer bc.db.Close()
+
+	var hash []byte
+	var err error
+
+	if blockHash != "" {
+		hash, err = hex.DecodeString(blockHash)
+		if err != nil {
+			fmt.Println("ERROR: Block hash is not valid")
+			os.Exit(1)
+		}
+	} else {
+		hash, err = bc.GetBlockHash(height)
+		if err != nil {
+			fmt.Printf("ERROR: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	block, err := bc.GetBlock(hash)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
+	}
+
+	// Blocks off the best chain have no undo data to compute fees from
+	fees, _ := bc.BlockFees(&block)
+	printBlock(&block, fees, cli.consensusEngine())
+}
+
+func (cli *CLI) getBlockCount() {
+	bc := NewBlockchain(cli.config.DBPath())
+	defer bc.db.Close()
+
+	fmt.Println(bc.GetBestHeight())
+}
+
+func (cli *CLI) getBestBlockHash() {
+	bc := NewBlockchain(cli.config.DBPath())
+	defer bc.db.Close()
+
+	fmt.Printf("%x\n", bc.tip)
+}
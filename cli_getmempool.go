@@ -0,0 +1,28 @@
+package main
+
+import "fmt"
+
+func (cli *CLI) getMempool() {
+	bc := NewBlockchain(cli.config.DBPath())
+	cli.configureBlockchain(bc)
+	defer bc.db.Close()
+
+	entries := Mempool{bc}.Entries()
+
+	size, fees, locked := 0, 0, 0
+	for _, entry := range entries {
+		txSize := entry.Transaction.Size()
+		size += txSize
+		fees += entry.Fee
+
+		status := ""
+		if !entry.Final {
+			status = " Locked until " + lockTimeString(entry.Transaction.LockTime)
+			locked++
+		}
+
+		fmt.Printf("%x Size: %d Fee: %d (%d per %d bytes)%s\n", entry.Transaction.ID, txSize, entry.Fee, FeeRate(entry.Fee, txSize), feeRateUnit, status)
+	}
+
+	fmt.Printf("Pending transactions: %d, %d bytes, %d of fees, %d locked\n", len(entries), size, fees, locked)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+func (cli *CLI) getMerkleProof(txID, out string) {
+	ID, err := hex.DecodeString(txID)
+	if err != nil {
+		fmt.Println("ERROR: Transaction ID is not valid")
+		os.Exit(1)
+	}
+
+	bc := NewBlockchain(cli.config.DBPath())
+	defer bc.db.Close()
+	cli.configureBlockchain(bc)
+
+	loc, err := bc.LocateTransaction(ID)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
+	}
+
+	block, err := bc.GetBlock(loc.BlockHash)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
+	}
+
+	proof, err := NewMerkleProof(&block, loc.Position)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
+	}
+
+	encoded := hex.EncodeToString(proof.Serialize())
+
+	if out == "" {
+		fmt.Println(encoded)
+		return
+	}
+
+	err = ioutil.WriteFile(out, []byte(encoded+"\n"), 0644)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Wrote the proof of transaction %x in block %x to %s\n", ID, block.Hash, out)
+}
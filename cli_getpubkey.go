@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+func (cli *CLI) getPubKey(address string) {
+	wallets, err := NewWallets(cli.config.WalletPath())
+	if err != nil {
+		log.Panic(err)
+	}
+
+	wallet, ok := wallets.Wallets[address]
+	if !ok {
+		fmt.Printf("ERROR: Address %s is not in the wallet file\n", address)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%x\n", wallet.PublicKey)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func (cli *CLI) getSupply(height int) {
+	bc := NewBlockchain(cli.config.DBPath())
+	defer bc.db.Close()
+
+	bestHeight := bc.GetBestHeight()
+	if height < 0 {
+		height = bestHeight
+	}
+
+	fmt.Printf("Height:             %d\n", height)
+	fmt.Printf("Block subsidy:      %d\n", activeParams.Emission.Subsidy(height))
+	fmt.Printf("Scheduled supply:   %d\n", activeParams.Emission.SupplyAt(height))
+	if height <= bestHeight {
+		supply, err := UTXOSet{bc}.CirculatingSupply(height)
+		if err != nil {
+			fmt.Printf("ERROR: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Circulating supply: %d\n", supply)
+	}
+	fmt.Printf("Maximum supply:     %d\n", activeParams.Emission.MaxSupply())
+}
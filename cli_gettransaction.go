@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+func (cli *CLI) getTransaction(txID string) {
+	ID, err := hex.DecodeString(txID)
+	if err != nil {
+		fmt.Println("ERROR: Transaction ID is not valid")
+		os.Exit(1)
+	}
+
+	bc := NewBlockchain(cli.config.DBPath())
+	defer bc.db.Close()
+	cli.configureBlockchain(bc)
+
+	loc, err := bc.LocateTransaction(ID)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
+	}
+
+	block, err := bc.GetBlock(loc.BlockHash)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
+	}
+
+	fees, _ := bc.BlockFees(&block)
+	printTransaction(block.Transactions[loc.Position], loc.Position, fees)
+	fmt.Printf("Block:         %x\n", block.Hash)
+	fmt.Printf("Position:      %d\n", loc.Position)
+	fmt.Printf("Confirmations: %d\n", bc.Confirmations(block.Hash))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+func (cli *CLI) importChain(in string) {
+	f, err := os.Open(in)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	cr, err := NewChainReader(f)
+	if err != nil {
+		fmt.Printf("ERROR: %s: %s\n", in, err)
+		os.Exit(1)
+	}
+
+	created := !dbExists(cli.config.DBPath())
+	db, err := OpenBoltStore(cli.config.DBPath())
+	if err != nil {
+		log.Panic(err)
+	}
+
+	imported, skipped, err := ImportChain(db, cr, cli.consensusEngine(), cli.configureBlockchain)
+	fmt.Printf("Imported %d blocks, skipped %d already stored\n", imported, skipped)
+
+	if err != nil {
+		db.Close()
+		if created && imported == 0 {
+			os.Remove(cli.config.DBPath())
+		}
+		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
+	}
+
+	if HasBlockchain(db) {
+		fmt.Printf("Best height: %d\n", LoadBlockchain(db).GetBestHeight())
+	}
+	db.Close()
+}
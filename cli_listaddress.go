@@ -6,7 +6,7 @@ import (
 )
 
 func (cli *CLI) listAddresses() {
-	wallets, err := NewWallets()
+	wallets, err := NewWallets(cli.config.WalletPath())
 	if err != nil {
 		log.Panic(err)
 	}
@@ -15,4 +15,8 @@ func (cli *CLI) listAddresses() {
 	for _, address := range addresses {
 		fmt.Println(address)
 	}
+
+	for address := range wallets.Scripts {
+		fmt.Println(address)
+	}
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+func (cli *CLI) mine(address string) {
+	if !ValidateAddress(address) {
+		log.Panic("ERROR: Address is not valid")
+	}
+
+	bc := NewBlockchain(cli.config.DBPath())
+	cli.configureBlockchain(bc)
+	defer bc.db.Close()
+
+	transactions := Mempool{bc}.Transactions()
+
+	ctx, cancel := cli.miningContext()
+	defer cancel()
+
+	block, err := bc.MineBlock(ctx, address, transactions)
+	if err != nil {
+		fmt.Printf("ERROR: Block was not mined: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Mined block %x at height %d with %d pending transactions\n", block.Hash, block.Height, len(transactions))
+}
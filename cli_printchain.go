@@ -2,29 +2,84 @@ package main
 
 import (
 	"fmt"
+	"log"
+	"os"
 	"strconv"
 )
 
-func (cli *CLI) printChain() {
-	bc := NewBlockchain("")
+func (cli *CLI) printChain(from, to int) {
+	bc := NewBlockchain(cli.config.DBPath())
 	defer bc.db.Close()
 
-	bci := bc.Iterator()
+	engine := cli.consensusEngine()
 
-	for {
-		block := bci.Next()
+	bestHeight := bc.GetBestHeight()
+	if to < 0 || to > bestHeight {
+		to = bestHeight
+	}
+	pruned := bc.PrunedHeight()
+
+	for height := to; height >= from; height-- {
+		hash, err := bc.GetBlockHash(height)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		// Only the headers of pruned blocks are left
+		if height < pruned {
+			header, err := bc.GetBlockHeader(hash)
+			if err != nil {
+				log.Panic(err)
+			}
 
-		fmt.Printf("============ Block %x ============\n", block.Hash)
-		fmt.Printf("Prev. block: %x\n", block.PrevBlockHash)
-		pow := NewProofOfWork(block)
-		fmt.Printf("PoW: %s\n\n", strconv.FormatBool(pow.Validate()))
-		for _, tx := range block.Transactions {
-			fmt.Println(tx)
+			printBlockHeader(&header, engine)
+			fmt.Printf("Transactions: pruned\n\n\n")
+			continue
 		}
-		fmt.Printf("\n\n")
 
-		if len(block.PrevBlockHash) == 0 {
-			break
+		block, err := bc.GetBlock(hash)
+		if err != nil {
+			fmt.Printf("ERROR: %s\n", err)
+			os.Exit(1)
 		}
+
+		fees, _ := bc.BlockFees(&block)
+		printBlock(&block, fees, engine)
+	}
+}
+
+// printBlock prints a block with the fees of its transactions, fees is nil
+// when they aren't known
+func printBlock(block *Block, fees []int, engine Engine) {
+	printBlockHeader(block.Header(), engine)
+	for i, tx := range block.Transactions {
+		printTransaction(tx, i, fees)
+	}
+	fmt.Printf("\n\n")
+}
+
+// printTransaction prints the transaction at position in its block, with its
+// fee when the fees of the block are known
+func printTransaction(tx *Transaction, position int, fees []int) {
+	if fees == nil || tx.IsCoinbase() {
+		fmt.Println(tx)
+		return
+	}
+
+	fmt.Println(tx.StringWithFee(fees[position]))
+}
+
+func printBlockHeader(block *BlockHeader, engine Engine) {
+	fmt.Printf("============ Block %x ============\n", block.Hash)
+	fmt.Printf("Height: %d\n", block.Height)
+	fmt.Printf("Version: %d\n", block.Version)
+	fmt.Printf("Prev. block: %x\n", block.PrevBlockHash)
+	fmt.Printf("Transactions root: %x\n", block.TxRoot)
+	if len(block.Signer) != 0 {
+		fmt.Printf("Signer: %s\n", encodeAddress(HashPubKey(block.Signer)))
+	} else {
+		fmt.Printf("Bits: %d\n", effectiveBits(block.Bits))
 	}
+	valid := engine.VerifySeal(block) == nil
+	fmt.Printf("%s: %s\n\n", engine.Name(), strconv.FormatBool(valid))
 }
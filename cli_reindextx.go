@@ -0,0 +1,21 @@
+package main
+
+import "fmt"
+
+func (cli *CLI) reindexTx(drop bool) {
+	bc := NewBlockchain(cli.config.DBPath())
+	defer bc.db.Close()
+
+	if drop {
+		bc.DropTxIndex()
+		fmt.Println("Done! The transaction index is dropped.")
+		return
+	}
+
+	if height := bc.PrunedHeight(); height > 0 {
+		fmt.Printf("Blocks below height %d are pruned, their transactions aren't indexed\n", height)
+	}
+
+	count := bc.ReindexTransactions()
+	fmt.Printf("Done! There are %d transactions in the index.\n", count)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func (cli *CLI) reindexUTXO() {
+	bc := NewBlockchain(cli.config.DBPath())
+	defer bc.db.Close()
+
+	if height := bc.PrunedHeight(); height > 0 {
+		fmt.Printf("ERROR: Blocks below height %d are pruned, the UTXO set can't be rebuilt\n", height)
+		os.Exit(1)
+	}
+
+	UTXOSet := UTXOSet{bc}
+	UTXOSet.Reindex()
+
+	count := UTXOSet.CountTransactions()
+	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", count)
+}
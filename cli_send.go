@@ -1,11 +1,8 @@
 package main
 
-import (
-	"fmt"
-	"log"
-)
+import "log"
 
-func (cli *CLI) send(from, to string, amount int) {
+func (cli *CLI) send(from, to string, amount, fee, feeRate, lockTime int, out string) {
 	if !ValidateAddress(from) {
 		log.Panic("ERROR: Sender address is not valid")
 	}
@@ -13,10 +10,34 @@ func (cli *CLI) send(from, to string, amount int) {
 		log.Panic("ERROR: Recipient address is not valid")
 	}
 
-	bc := NewBlockchain(from)
+	bc := NewBlockchain(cli.config.DBPath())
+	cli.configureBlockchain(bc)
 	defer bc.db.Close()
 
-	tx := NewUTXOTransaction(from, to, amount, bc)
-	bc.MineBlock([]*Transaction{tx})
-	fmt.Println("Success!")
+	UTXOSet := UTXOSet{bc}
+
+	wallets, err := NewWallets(cli.config.WalletPath())
+	if err != nil {
+		log.Panic(err)
+	}
+
+	var tx *Transaction
+	if redeemScript, ok := wallets.Scripts[from]; ok {
+		if feeRate > 0 {
+			tx = NewMultisigTransactionAtFeeRate(redeemScript, to, amount, feeRate, lockTime, &UTXOSet)
+		} else {
+			tx = NewMultisigTransaction(redeemScript, to, amount, fee, lockTime, &UTXOSet)
+		}
+		cli.signWithWallets(bc, tx, wallets)
+	} else {
+		wallet := wallets.GetWallet(from)
+
+		if feeRate > 0 {
+			tx = NewUTXOTransactionAtFeeRate(&wallet, to, amount, feeRate, lockTime, &UTXOSet)
+		} else {
+			tx = NewUTXOTransaction(&wallet, to, amount, fee, lockTime, &UTXOSet)
+		}
+	}
+
+	cli.submitTransaction(bc, tx, out)
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+func (cli *CLI) signTransaction(file string) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	decoded, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		fmt.Println("ERROR: Transaction file is not hex encoded")
+		os.Exit(1)
+	}
+
+	tx, err := DeserializeTransaction(decoded)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
+	}
+
+	bc := NewBlockchain(cli.config.DBPath())
+	cli.configureBlockchain(bc)
+	defer bc.db.Close()
+
+	wallets, err := NewWallets(cli.config.WalletPath())
+	if err != nil {
+		log.Panic(err)
+	}
+
+	cli.signWithWallets(bc, tx, wallets)
+	cli.submitTransaction(bc, tx, file)
+}
+
+// signWithWallets adds the signatures of the keys of the wallet file to a
+// transaction
+func (cli *CLI) signWithWallets(bc *Blockchain, tx *Transaction, wallets *Wallets) {
+	spent, err := UTXOSet{bc}.FindSpentOutputs(tx)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
+	}
+	prevTXs := prevTXsFromOutputs(tx, spent)
+
+	for _, wallet := range wallets.Wallets {
+		tx.Sign(wallet.PrivateKey, prevTXs)
+	}
+}
+
+// submitTransaction adds a fully signed transaction to the mempool. A
+// transaction whose only fault is missing signatures of multisig inputs is
+// written to file in hex instead, for the other signers to sign it with
+// signtransaction.
+func (cli *CLI) submitTransaction(bc *Blockchain, tx *Transaction, file string) {
+	spent, err := UTXOSet{bc}.FindSpentOutputs(tx)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
+	}
+	fee := bc.TransactionFee(tx)
+
+	for i, vin := range tx.Vin {
+		if signatures, required, ok := vin.MultisigSignatures(); ok {
+			fmt.Printf("Input %d: %d of %d signatures\n", i, signatures, required)
+		}
+	}
+
+	missing, err := tx.verifyPartialInputs(prevTXsFromOutputs(tx, spent))
+	if err != nil {
+		fmt.Printf("ERROR: Transaction is invalid: %s\n", err)
+		os.Exit(1)
+	}
+
+	if missing {
+		if file == "" {
+			fmt.Println("ERROR: Transaction is missing signatures, give -out FILE to pass it to the other signers")
+			os.Exit(1)
+		}
+
+		err := ioutil.WriteFile(file, []byte(hex.EncodeToString(tx.Serialize())+"\n"), 0644)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		fmt.Printf("Wrote the partially signed transaction %x to %s\n", tx.ID, file)
+		return
+	}
+
+	err = Mempool{bc}.Add(tx)
+	if err != nil {
+		fmt.Printf("ERROR: Transaction was rejected: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Fee: %d for %d bytes (%d per %d bytes)\n", fee, tx.Size(), FeeRate(fee, tx.Size()), feeRateUnit)
+	fmt.Printf("Transaction %x added to the mempool\n", tx.ID)
+	for _, entry := range (Mempool{bc}).Entries() {
+		if bytes.Equal(entry.Transaction.ID, tx.ID) && !entry.Final {
+			fmt.Printf("It stays in the mempool until its lock time, %s, passes\n", lockTimeString(tx.LockTime))
+		}
+	}
+}
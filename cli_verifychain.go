@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func (cli *CLI) verifyChain(depth, level int) {
+	bc := NewBlockchain(cli.config.DBPath())
+	cli.configureBlockchain(bc)
+
+	if pruned := bc.PrunedHeight(); pruned > 0 && level > verifyTransactions {
+		fmt.Printf("Blocks below height %d are pruned, checking at level %d\n", pruned, verifyTransactions)
+		level = verifyTransactions
+	}
+
+	err := bc.VerifyChain(depth, level)
+	bestHeight := bc.GetBestHeight()
+	bc.db.Close()
+
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Chain is valid up to height %d (level %d)\n", bestHeight, level)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+func (cli *CLI) verifyMerkleProof(file string) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	decoded, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		fmt.Println("ERROR: Proof file is not hex encoded")
+		os.Exit(1)
+	}
+
+	proof, err := DeserializeMerkleProof(decoded)
+	if err == nil {
+		err = proof.Verify(cli.consensusEngine())
+	}
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(proof.Transaction)
+	fmt.Printf("Block:    %x\n", proof.Header.Hash)
+	fmt.Printf("Height:   %d\n", proof.Header.Height)
+	fmt.Printf("Position: %d\n", proof.Index)
+	fmt.Println("Proof is valid")
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const configFile = "blockchain.conf"
+const dataDirEnv = "BLOCKCHAIN_DATADIR"
+
+// Config holds the settings of a node instance
+type Config struct {
+	DataDir    string
+	WalletFile string
+	Prune      int
+	Miners     int
+
+	// TxIndex keeps an index of the best chain transactions by ID, built
+	// when missing, so lookups don't scan the chain
+	TxIndex bool
+
+	// MaxFutureDrift is how many seconds ahead of the clock a block may be
+	MaxFutureDrift int
+
+	// Consensus is the engine sealing the blocks, pow or poa. Authorities are
+	// the addresses signing the blocks of a poa chain, in the order of their turns.
+	Consensus   string
+	Authorities []string
+}
+
+// LoadConfig resolves the data directory of the network and reads the
+// optional config file kept in it. An empty dataDir falls back to the
+// BLOCKCHAIN_DATADIR environment variable and then to the current directory.
+// The network keeps its files in its DataSubdir of it.
+func LoadConfig(dataDir string, params *ChainParams) (*Config, error) {
+	if dataDir == "" {
+		dataDir = os.Getenv(dataDirEnv)
+	}
+	if dataDir == "" {
+		dataDir = "."
+	}
+	dataDir = filepath.Join(dataDir, params.DataSubdir)
+
+	err := os.MkdirAll(dataDir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{DataDir: dataDir, MaxFutureDrift: int(defaultMaxFutureDrift / time.Second), Consensus: "pow"}
+
+	path := filepath.Join(dataDir, configFile)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, lineNum)
+		}
+
+		err = config.set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, lineNum, err)
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Consensus == "poa" && len(config.Authorities) == 0 {
+		return nil, fmt.Errorf("%s: poa consensus needs authorities", path)
+	}
+
+	return config, nil
+}
+
+// set applies a single setting of the config file
+func (c *Config) set(key, value string) error {
+	switch key {
+	case "wallet":
+		c.WalletFile = c.resolve(value)
+	case "prune":
+		depth, err := strconv.Atoi(value)
+		if err != nil || depth < 0 {
+			return fmt.Errorf("prune must be a number of blocks, got %q", value)
+		}
+		c.Prune = depth
+	case "txindex":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("txindex must be true or false, got %q", value)
+		}
+		c.TxIndex = enabled
+	case "miners":
+		workers, err := strconv.Atoi(value)
+		if err != nil || workers < 0 {
+			return fmt.Errorf("miners must be a number of workers, got %q", value)
+		}
+		c.Miners = workers
+	case "maxfuturedrift":
+		drift, err := strconv.Atoi(value)
+		if err != nil || drift < 0 {
+			return fmt.Errorf("maxfuturedrift must be a number of seconds, got %q", value)
+		}
+		c.MaxFutureDrift = drift
+	case "consensus":
+		if value != "pow" && value != "poa" {
+			return fmt.Errorf("consensus must be pow or poa, got %q", value)
+		}
+		c.Consensus = value
+	case "authorities":
+		c.Authorities = nil
+		for _, address := range strings.Split(value, ",") {
+			address = strings.TrimSpace(address)
+			if !ValidateAddress(address) {
+				return fmt.Errorf("authority %q is not a valid address", address)
+			}
+			c.Authorities = append(c.Authorities, address)
+		}
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+
+	return nil
+}
+
+// resolve makes a path from the config file relative to the data directory
+func (c *Config) resolve(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(c.DataDir, path)
+}
+
+// DBPath returns the path of the blockchain database
+func (c *Config) DBPath() string {
+	return filepath.Join(c.DataDir, dbFile)
+}
+
+// WalletPath returns the path of the wallet file
+func (c *Config) WalletPath() string {
+	if c.WalletFile != "" {
+		return c.WalletFile
+	}
+
+	return filepath.Join(c.DataDir, walletFile)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"math/big"
+)
+
+// Engine is the consensus engine of a chain. It decides how blocks are sealed,
+// which seals are valid and how much a block weighs when the best chain is
+// chosen.
+type Engine interface {
+	// Name is the short name of the engine shown next to the seal of a block
+	Name() string
+
+	// Prepare sets the consensus fields of a header to be sealed on top of
+	// parent. Both tx and parent are nil for the genesis block.
+	Prepare(tx StoreTx, header, parent *BlockHeader) error
+
+	// Seal completes a prepared header with its hash and seal. It fails when
+	// ctx is done before the header is sealed.
+	Seal(ctx context.Context, header *BlockHeader) error
+
+	// VerifyHeader checks the consensus fields and the seal of a header on top
+	// of parent, nil for the genesis block
+	VerifyHeader(tx StoreTx, header, parent *BlockHeader) error
+
+	// VerifySeal checks the seal of a header on its own
+	VerifySeal(header *BlockHeader) error
+
+	// Work returns the weight a block adds to the chain it extends
+	Work(header *BlockHeader) *big.Int
+}
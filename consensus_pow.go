@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ProofOfWorkEngine seals blocks by mining them at the difficulty set by
+// nextBits. The best chain is the one with the most work.
+type ProofOfWorkEngine struct {
+	miner *Miner
+}
+
+// NewProofOfWorkEngine returns a ProofOfWorkEngine mining with miner
+func NewProofOfWorkEngine(miner *Miner) *ProofOfWorkEngine {
+	return &ProofOfWorkEngine{miner}
+}
+
+// Name returns the short name of the engine
+func (e *ProofOfWorkEngine) Name() string {
+	return "PoW"
+}
+
+// Prepare sets the difficulty bits of the header
+func (e *ProofOfWorkEngine) Prepare(tx StoreTx, header, parent *BlockHeader) error {
+	header.Bits = nextBits(tx, parent)
+
+	return nil
+}
+
+// Seal mines the header
+func (e *ProofOfWorkEngine) Seal(ctx context.Context, header *BlockHeader) error {
+	return e.miner.Mine(ctx, header)
+}
+
+// VerifyHeader checks that the header has no signature, the difficulty bits
+// expected on top of parent and a valid proof-of-work. Only the legacy blocks
+// a migrated chain starts with have no bits.
+func (e *ProofOfWorkEngine) VerifyHeader(tx StoreTx, header, parent *BlockHeader) error {
+	if len(header.Signer) != 0 || len(header.Signature) != 0 {
+		return errors.New("proof-of-work block carries a signature")
+	}
+
+	if header.Height < legacyHeight(tx) {
+		if header.Bits != 0 {
+			return errors.New("legacy block has difficulty bits")
+		}
+	} else if expected := nextBits(tx, parent); header.Bits != expected {
+		return fmt.Errorf("difficulty bits %d don't match the expected %d", header.Bits, expected)
+	}
+
+	return e.VerifySeal(header)
+}
+
+// VerifySeal checks the proof-of-work of the header
+func (e *ProofOfWorkEngine) VerifySeal(header *BlockHeader) error {
+	if !NewHeaderProofOfWork(header).Validate() {
+		return errors.New("proof of work is invalid")
+	}
+
+	return nil
+}
+
+// Work returns the expected number of hashes needed to mine the block
+func (e *ProofOfWorkEngine) Work(header *BlockHeader) *big.Int {
+	return NewHeaderProofOfWork(header).Work()
+}
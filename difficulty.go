@@ -0,0 +1,78 @@
+package main
+
+// The difficulty of a block is given by its bits: the number of leading zero
+// bits its hash must have. Blocks mined before the difficulty was stored in
+// blocks have 0 bits and were all mined at legacyTargetBits.
+const legacyTargetBits = 24
+
+// Every retargetInterval blocks the bits are adjusted so that blocks come
+// every targetBlockTime seconds. A retarget changes the bits by at most
+// maxRetargetStep, each step doubling or halving the work of a block.
+const retargetInterval = 10
+const targetBlockTime = 10
+const maxRetargetStep = 2
+
+// Bounds of the difficulty bits of non-legacy blocks
+const minTargetBits = 1
+const maxTargetBits = 255
+
+// effectiveBits returns the difficulty a block with the given bits is mined at
+func effectiveBits(bits int) int {
+	if bits == 0 {
+		return legacyTargetBits
+	}
+
+	return bits
+}
+
+// nextBits returns the difficulty bits required for the block following
+// parent, a nil parent standing for the genesis block, which gets the
+// TargetBits of the network. Blocks at multiples of retargetInterval are
+// retargeted from the time the previous blocks took, unless the network
+// doesn't retarget.
+func nextBits(tx StoreTx, parent *BlockHeader) int {
+	if parent == nil {
+		return activeParams.TargetBits
+	}
+
+	bits := effectiveBits(parent.Bits)
+	height := parent.Height + 1
+	if activeParams.NoRetarget || height%retargetInterval != 0 {
+		return bits
+	}
+
+	first := parent
+	for first.Height > height-retargetInterval {
+		first = getHeader(tx, first.PrevBlockHash)
+	}
+
+	return retarget(bits, parent.Timestamp-first.Timestamp)
+}
+
+// retarget adjusts bits for blocks that took timespan seconds to cover
+// retargetInterval-1 block intervals. It adds a bit each time the blocks came
+// twice as fast as intended and removes one each time they came twice as slow.
+func retarget(bits int, timespan int64) int {
+	expected := int64(retargetInterval-1) * targetBlockTime
+	if timespan < 1 {
+		timespan = 1
+	}
+
+	step := 0
+	for step < maxRetargetStep && timespan<<uint(step+1) <= expected {
+		step++
+	}
+	for step <= 0 && step > -maxRetargetStep && timespan >= expected<<uint(1-step) {
+		step--
+	}
+
+	bits += step
+	if bits < minTargetBits {
+		bits = minTargetBits
+	}
+	if bits > maxTargetBits {
+		bits = maxTargetBits
+	}
+
+	return bits
+}
@@ -0,0 +1,52 @@
+package main
+
+// EmissionSchedule sets the coins created by each block. The subsidy starts
+// at InitialSubsidy and halves every HalvingInterval blocks, so the supply is
+// capped once it reaches 0.
+type EmissionSchedule struct {
+	InitialSubsidy  int
+	HalvingInterval int
+}
+
+// Subsidy returns the coins a block at height may create on top of the fees
+// of its transactions
+func (s EmissionSchedule) Subsidy(height int) int {
+	halvings := uint(height / s.HalvingInterval)
+	if halvings >= 63 {
+		return 0
+	}
+
+	return s.InitialSubsidy >> halvings
+}
+
+// SupplyAt returns the coins created by the subsidies of the blocks up to and
+// including height
+func (s EmissionSchedule) SupplyAt(height int) int {
+	supply := 0
+
+	for start := 0; start <= height; start += s.HalvingInterval {
+		subsidy := s.Subsidy(start)
+		if subsidy == 0 {
+			break
+		}
+
+		blocks := s.HalvingInterval
+		if height-start+1 < blocks {
+			blocks = height - start + 1
+		}
+		supply += blocks * subsidy
+	}
+
+	return supply
+}
+
+// MaxSupply returns the coins created once the subsidy has dropped to 0
+func (s EmissionSchedule) MaxSupply() int {
+	supply := 0
+
+	for subsidy := s.InitialSubsidy; subsidy > 0; subsidy >>= 1 {
+		supply += subsidy * s.HalvingInterval
+	}
+
+	return supply
+}
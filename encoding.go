@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Blocks and transactions use a fixed binary layout so that their bytes, and
+// therefore their hashes, can be reproduced by any implementation:
+//
+//	Transaction:
+//	  uint32 version
+//	  bytes  ID
+//	  uint32 input count, then for each input:
+//	    bytes Txid, int64 Vout, bytes ScriptSig
+//	  uint32 output count, then for each output:
+//	    int64 Value, bytes ScriptPubKey
+//	  uint32 LockTime
+//
+// Legacy transactions, version 0, are stored in the same layout but hashed as
+// described in legacy_gob.go.
+//
+//	Block (layout 1):
+//	  uint32 layout
+//	  header fields, as in BlockHeader
+//	  uint32 transaction count, then each transaction
+//
+//	BlockHeader (layout 1):
+//	  uint32 layout
+//	  uint32 Version
+//	  int64  Timestamp
+//	  bytes  PrevBlockHash
+//	  bytes  TxRoot
+//	  bytes  Hash
+//	  uint32 Bits
+//	  int64  Nonce
+//	  int64  Height
+//	  bytes  Signer
+//	  bytes  Signature
+//
+// Integers are big-endian. bytes is a uint32 length followed by that many
+// bytes. A transaction is hashed with its ID left empty.
+//
+// The proof-of-work of a version 1 block header hashes its fields in a fixed
+// 88 byte layout, with no length prefixes:
+//
+//	uint32   Version
+//	[32]byte PrevBlockHash, all zeros for the genesis block
+//	[32]byte TxRoot
+//	int64    Timestamp
+//	uint32   Bits
+//	int64    Nonce
+//
+// The signature of a block sealed by an authority covers its hash, which
+// doesn't include the signer: the height of the block decides who signs it.
+
+// maxEncodedLen bounds the lengths and counts read by a decoder, so corrupted
+// input can't make it allocate unbounded memory
+const maxEncodedLen = 32 << 20
+
+// encoder writes the primitives of the binary layout. The first error is kept
+// and makes the following writes no-ops.
+type encoder struct {
+	w   io.Writer
+	err error
+}
+
+func (e *encoder) write(data []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(data)
+	}
+}
+
+func (e *encoder) uint32(v uint32) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	e.write(buf[:])
+}
+
+func (e *encoder) int64(v int64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(v))
+	e.write(buf[:])
+}
+
+func (e *encoder) count(n int) {
+	if n > math.MaxUint32 && e.err == nil {
+		e.err = fmt.Errorf("length %d doesn't fit the encoding", n)
+	}
+	e.uint32(uint32(n))
+}
+
+func (e *encoder) bytes(data []byte) {
+	e.count(len(data))
+	e.write(data)
+}
+
+// decoder reads the primitives of the binary layout. The first error is kept
+// and makes the following reads return zero values.
+type decoder struct {
+	r   io.Reader
+	err error
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	data := make([]byte, n)
+	_, err := io.ReadFull(d.r, data)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = errors.New("data is truncated")
+	}
+	d.err = err
+
+	return data
+}
+
+func (d *decoder) uint32() uint32 {
+	data := d.read(4)
+	if d.err != nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(data)
+}
+
+func (d *decoder) int64() int64 {
+	data := d.read(8)
+	if d.err != nil {
+		return 0
+	}
+
+	return int64(binary.BigEndian.Uint64(data))
+}
+
+func (d *decoder) count() int {
+	n := d.uint32()
+	if n > maxEncodedLen && d.err == nil {
+		d.err = fmt.Errorf("length %d is too large", n)
+	}
+	if d.err != nil {
+		return 0
+	}
+
+	return int(n)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	if d.err != nil {
+		return nil
+	}
+
+	return d.read(n)
+}
+
+// decodeAll decodes data with decode and fails when bytes are left over
+func decodeAll(data []byte, decode func(r io.Reader) error) error {
+	r := bytes.NewReader(data)
+
+	err := decode(r)
+	if err != nil {
+		return err
+	}
+
+	if r.Len() != 0 {
+		return fmt.Errorf("%d unexpected trailing bytes", r.Len())
+	}
+
+	return nil
+}
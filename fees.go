@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// Fee rates are given in coins per feeRateUnit bytes of serialized transaction
+const feeRateUnit = 1000
+
+// FeeForSize returns the fee paying rate for a transaction of size bytes,
+// rounded up
+func FeeForSize(rate, size int) int {
+	return (rate*size + feeRateUnit - 1) / feeRateUnit
+}
+
+// FeeRate returns the rate a fee pays for a transaction of size bytes,
+// rounded down
+func FeeRate(fee, size int) int {
+	return fee * feeRateUnit / size
+}
+
+// blockFees returns the fee of each transaction of a block connected to the
+// best chain, from the outputs its undo data says the block spent. The fee of
+// the coinbase is 0.
+func blockFees(tx StoreTx, block *Block) ([]int, error) {
+	undoData := tx.Get(undoBucket, block.Hash)
+	if undoData == nil {
+		return nil, fmt.Errorf("undo data of block %x is missing", block.Hash)
+	}
+	spent := DeserializeBlockUndo(undoData).Spent
+
+	fees := make([]int, len(block.Transactions))
+	for i, btx := range block.Transactions {
+		if btx.IsCoinbase() {
+			continue
+		}
+
+		if len(spent) < len(btx.Vin) {
+			return nil, fmt.Errorf("undo data of block %x doesn't match its transactions", block.Hash)
+		}
+
+		inValue := 0
+		for _, out := range spent[:len(btx.Vin)] {
+			inValue += out.Output.Value
+		}
+		spent = spent[len(btx.Vin):]
+
+		fees[i] = inValue - btx.OutputValue()
+	}
+
+	return fees, nil
+}
+
+// newBlockFees returns the fees the transactions of a block to be mined on
+// the best chain pay. A transaction can spend outputs of the transactions
+// before it in the block.
+func newBlockFees(tx StoreTx, transactions []*Transaction) (int, error) {
+	created := make(map[string]TXOutput)
+	fees := 0
+
+	for _, transaction := range transactions {
+		inValue := 0
+		for _, vin := range transaction.Vin {
+			out, ok := created[outpointKey(vin.Txid, vin.Vout)]
+			if !ok {
+				var outs TXOutputs
+				if data := tx.Get(utxoBucket, vin.Txid); data != nil {
+					outs = DeserializeOutputs(data)
+				}
+
+				out, ok = outs.Outputs[vin.Vout]
+				if !ok {
+					return 0, fmt.Errorf("output %x:%d is not found or already spent", vin.Txid, vin.Vout)
+				}
+			}
+			inValue += out.Value
+		}
+		fees += inValue - transaction.OutputValue()
+
+		for i, out := range transaction.Vout {
+			created[outpointKey(transaction.ID, i)] = out
+		}
+	}
+
+	return fees, nil
+}
+
+// BlockFees returns the fee of each transaction of a block of the best chain
+func (bc *Blockchain) BlockFees(block *Block) ([]int, error) {
+	var fees []int
+
+	err := bc.db.View(func(tx StoreTx) error {
+		var err error
+		fees, err = blockFees(tx, block)
+
+		return err
+	})
+
+	return fees, err
+}
+
+// EstimateFeeRate suggests a fee rate: the median of the rates paid by the
+// transactions of the given number of latest blocks. Pruned blocks end the
+// search. It also returns the number of transactions the estimate is based on,
+// with no transactions there's no estimate.
+func (bc *Blockchain) EstimateFeeRate(blocks int) (int, int) {
+	var rates []int
+
+	err := bc.db.View(func(tx StoreTx) error {
+		hash := tx.Tip()
+
+		for i := 0; i < blocks && len(hash) != 0; i++ {
+			block := tx.GetBlock(hash)
+			if block == nil {
+				break
+			}
+
+			fees, err := blockFees(tx, block)
+			if err != nil {
+				return err
+			}
+
+			for j, btx := range block.Transactions {
+				if !btx.IsCoinbase() {
+					rates = append(rates, FeeRate(fees[j], btx.Size()))
+				}
+			}
+
+			hash = block.PrevBlockHash
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if len(rates) == 0 {
+		return 0, 0
+	}
+
+	sort.Ints(rates)
+
+	return rates[len(rates)/2], len(rates)
+}
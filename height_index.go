@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+)
+
+const heightsBucket = "heights"
+
+// indexHeight maps the height of the block to its hash
+func indexHeight(tx StoreTx, block *Block) error {
+	return tx.Put(heightsBucket, IntToHex(int64(block.Height)), block.Hash)
+}
+
+// GetBestHeight returns the height of the latest block
+func (bc *Blockchain) GetBestHeight() int {
+	block, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return block.Height
+}
+
+// GetBlockHash returns the hash of the best chain block at the given height
+func (bc *Blockchain) GetBlockHash(height int) ([]byte, error) {
+	var hash []byte
+
+	err := bc.db.View(func(tx StoreTx) error {
+		data := tx.Get(heightsBucket, IntToHex(int64(height)))
+		if data == nil {
+			return errors.New("Block height is out of range")
+		}
+		hash = append([]byte{}, data...)
+
+		return nil
+	})
+
+	return hash, err
+}
+
+// unindexHeight removes the height of a disconnected block from the index
+func unindexHeight(tx StoreTx, block *Block) error {
+	return tx.Delete(heightsBucket, IntToHex(int64(block.Height)))
+}
+
+// isOnBestChain reports whether the block is part of the best chain
+func isOnBestChain(tx StoreTx, block *BlockHeader) bool {
+	return bytes.Compare(tx.Get(heightsBucket, IntToHex(int64(block.Height))), block.Hash) == 0
+}
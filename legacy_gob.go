@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"math/big"
+)
+
+// Blocks used to be stored, and transactions hashed, with encoding/gob. The
+// functions in this file read the old encoding and reproduce the hashes of
+// legacy transactions, so that chains created before the binary layout keep
+// their transaction IDs and proofs-of-work.
+
+// legacyHeightKey is the key in the blocks bucket of the number of legacy
+// blocks a migrated chain starts with
+var legacyHeightKey = []byte("legacy")
+
+func init() {
+	// gob numbers types globally in the order they are first encoded, and the
+	// numbers end up in the serialized bytes. Hashing a legacy transaction
+	// before anything else keeps legacy hashes the same in every process.
+	legacyTransactionHash(&Transaction{})
+}
+
+// legacyTransactionHash hashes a transaction the way it was hashed when it was
+// serialized with gob. The types mirror the transaction types of that time,
+// down to their names, because gob writes both into its output.
+func legacyTransactionHash(tx *Transaction) []byte {
+	type TXInput struct {
+		Txid      []byte
+		Vout      int
+		Signature []byte
+		PubKey    []byte
+	}
+
+	type TXOutput struct {
+		Value      int
+		PubKeyHash []byte
+	}
+
+	type Transaction struct {
+		ID   []byte
+		Vin  []TXInput
+		Vout []TXOutput
+	}
+
+	legacyTx := Transaction{ID: tx.ID}
+	for _, vin := range tx.Vin {
+		signature, pubKey, _ := extractP2PKHUnlocking(vin.ScriptSig)
+		legacyTx.Vin = append(legacyTx.Vin, TXInput{vin.Txid, vin.Vout, signature, pubKey})
+	}
+	for _, out := range tx.Vout {
+		pubKeyHash, _ := extractP2PKH(out.ScriptPubKey)
+		legacyTx.Vout = append(legacyTx.Vout, TXOutput{out.Value, pubKeyHash})
+	}
+
+	var encoded bytes.Buffer
+	err := gob.NewEncoder(&encoded).Encode(legacyTx)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	hash := sha256.Sum256(encoded.Bytes())
+
+	return hash[:]
+}
+
+// legacyHeight returns the number of legacy blocks the chain starts with: the
+// blocks it had when it was migrated, 0 for a chain created in the binary
+// layout. Only those blocks may have a legacy header.
+func legacyHeight(tx StoreTx) int {
+	data := tx.Get(blocksBucket, legacyHeightKey)
+	if data == nil {
+		return 0
+	}
+
+	return int(HexToInt(data))
+}
+
+// setLegacyHeight records the number of legacy blocks the chain starts with
+func setLegacyHeight(tx StoreTx, height int) error {
+	err := tx.CreateBucket(blocksBucket)
+	if err != nil {
+		return err
+	}
+
+	return tx.Put(blocksBucket, legacyHeightKey, IntToHex(int64(height)))
+}
+
+// decodeLegacyBlock decodes a gob encoded block. Its transactions get the
+// legacy version and its header the legacy version with the transactions root
+// computed from them. Legacy blocks don't carry their height.
+func decodeLegacyBlock(data []byte) (*Block, error) {
+	var legacyBlock struct {
+		Timestamp    int64
+		Transactions []struct {
+			ID  []byte
+			Vin []struct {
+				Txid      []byte
+				Vout      int
+				Signature []byte
+				PubKey    []byte
+			}
+			Vout []struct {
+				Value      int
+				PubKeyHash []byte
+			}
+		}
+		PrevBlockHash []byte
+		Hash          []byte
+		Nonce         int
+	}
+
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&legacyBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []*Transaction
+	for _, legacyTx := range legacyBlock.Transactions {
+		tx := &Transaction{Version: legacyTxVersion, ID: legacyTx.ID}
+
+		for _, vin := range legacyTx.Vin {
+			tx.Vin = append(tx.Vin, TXInput{vin.Txid, vin.Vout, NewP2PKHUnlockingScript(vin.Signature, vin.PubKey)})
+		}
+		for _, out := range legacyTx.Vout {
+			tx.Vout = append(tx.Vout, TXOutput{out.Value, NewP2PKHScript(out.PubKeyHash)})
+		}
+
+		transactions = append(transactions, tx)
+	}
+
+	block := &Block{
+		BlockHeader{
+			Version:       legacyHeaderVersion,
+			Timestamp:     legacyBlock.Timestamp,
+			PrevBlockHash: legacyBlock.PrevBlockHash,
+			Hash:          legacyBlock.Hash,
+			Nonce:         legacyBlock.Nonce,
+		},
+		transactions,
+	}
+	block.TxRoot = block.HashTransactions()
+
+	return block, nil
+}
+
+// migrateLegacyChain upgrades a database created before the binary layout,
+// which holds the blocks of the best chain only: they are rewritten in the
+// binary layout with their heights, and the height index, chainwork, undo
+// data and UTXO set are built from them. Blocks added later can't be legacy
+// blocks. It all happens in one store transaction, so an interrupted
+// migration starts over.
+func (bc *Blockchain) migrateLegacyChain() {
+	err := bc.db.Update(func(tx StoreTx) error {
+		var chain []*Block
+
+		for hash := tx.Tip(); len(hash) > 0; {
+			data := tx.Get(blocksBucket, hash)
+			if data == nil {
+				return fmt.Errorf("block %x is missing", hash)
+			}
+
+			block, err := decodeLegacyBlock(data)
+			if err != nil {
+				return fmt.Errorf("block %x: %s", hash, err)
+			}
+			chain = append(chain, block)
+			hash = block.PrevBlockHash
+		}
+
+		for _, bucket := range []string{utxoBucket, undoBucket, heightsBucket, chainworkBucket} {
+			err := tx.CreateBucket(bucket)
+			if err != nil {
+				return err
+			}
+		}
+
+		// The outputs spent by each block are taken from the outputs of the
+		// blocks below it, collected while walking up the chain. Those left
+		// over make up the UTXO set.
+		work := new(big.Int)
+		origins := make(map[string]SpentOutput)
+
+		for i := len(chain) - 1; i >= 0; i-- {
+			block := chain[i]
+			block.Height = len(chain) - 1 - i
+
+			undo := BlockUndo{}
+			for _, btx := range block.Transactions {
+				if !btx.IsCoinbase() {
+					for _, vin := range btx.Vin {
+						key := outpointKey(vin.Txid, vin.Vout)
+						spent, ok := origins[key]
+						if !ok {
+							return fmt.Errorf("output %s spent at height %d is not found", key, block.Height)
+						}
+						delete(origins, key)
+
+						undo.Spent = append(undo.Spent, spent)
+					}
+				}
+
+				for outIdx, out := range btx.Vout {
+					origins[outpointKey(btx.ID, outIdx)] = SpentOutput{btx.ID, outIdx, out, btx.IsCoinbase(), block.Height}
+				}
+			}
+
+			err := tx.PutBlock(block)
+			if err != nil {
+				return err
+			}
+
+			err = indexHeight(tx, block)
+			if err != nil {
+				return err
+			}
+
+			work.Add(work, bc.engine.Work(block.Header()))
+			err = tx.Put(chainworkBucket, block.Hash, work.Bytes())
+			if err != nil {
+				return err
+			}
+
+			err = tx.Put(undoBucket, block.Hash, undo.Serialize())
+			if err != nil {
+				return err
+			}
+		}
+
+		UTXO := make(map[string]TXOutputs)
+		for _, spent := range origins {
+			txID := string(spent.Txid)
+
+			outs, ok := UTXO[txID]
+			if !ok {
+				outs = TXOutputs{make(map[int]TXOutput), spent.Coinbase, spent.Height}
+			}
+			outs.Outputs[spent.Vout] = spent.Output
+			UTXO[txID] = outs
+		}
+
+		for txID, outs := range UTXO {
+			err := tx.Put(utxoBucket, []byte(txID), outs.Serialize())
+			if err != nil {
+				return err
+			}
+		}
+
+		err := setLegacyHeight(tx, len(chain))
+		if err != nil {
+			return err
+		}
+
+		return tx.Put(blocksBucket, blocksFormatKey, IntToHex(blockLayout))
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
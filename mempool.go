@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+)
+
+const mempoolBucket = "mempool"
+
+// Mempool represents the transactions waiting to be mined, stored in the
+// mempool bucket by ID. Pending transactions spend outputs of the best chain
+// or of other pending transactions, and no two of them spend the same output.
+// Transactions that aren't final yet wait in the mempool until their lock time
+// passes.
+type Mempool struct {
+	Blockchain *Blockchain
+}
+
+// MempoolEntry is a pending transaction with the fee it pays and whether it
+// is final in the next block
+type MempoolEntry struct {
+	Transaction *Transaction
+	Fee         int
+	Final       bool
+}
+
+// outpointKey identifies the output vout of the transaction txID
+func outpointKey(txID []byte, vout int) string {
+	return fmt.Sprintf("%x:%d", txID, vout)
+}
+
+// Add validates a transaction against the best chain and the pending
+// transactions and adds it to the mempool. The pending transactions it spends
+// outputs of must be added first.
+func (m Mempool) Add(transaction *Transaction) error {
+	if transaction.IsCoinbase() {
+		return errors.New("coinbase transactions can't be added to the mempool")
+	}
+
+	err := checkTransaction(transaction)
+	if err != nil {
+		return err
+	}
+
+	return m.Blockchain.db.Update(func(tx StoreTx) error {
+		err := tx.CreateBucket(mempoolBucket)
+		if err != nil {
+			return err
+		}
+
+		if tx.Get(mempoolBucket, transaction.ID) != nil {
+			return fmt.Errorf("transaction %x is already in the mempool", transaction.ID)
+		}
+
+		pending, err := pendingSpends(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, vin := range transaction.Vin {
+			if pending[outpointKey(vin.Txid, vin.Vout)] {
+				return fmt.Errorf("output %x:%d is already spent by a transaction in the mempool", vin.Txid, vin.Vout)
+			}
+		}
+
+		fee, spent, err := pendingInputs(tx, transaction)
+		if err != nil {
+			return err
+		}
+
+		if fee < 0 {
+			return fmt.Errorf("transaction %x creates %d from inputs worth %d", transaction.ID, transaction.OutputValue(), transaction.OutputValue()+fee)
+		}
+
+		err = checkTransactionSignatures(transaction, spent)
+		if err != nil {
+			return err
+		}
+
+		return tx.Put(mempoolBucket, transaction.ID, transaction.Serialize())
+	})
+}
+
+// Entries returns the pending transactions, the highest fee rate first, but
+// each after the pending transactions it spends outputs of. Transactions that
+// no longer fit the best chain, as their inputs were disconnected in a
+// reorganization or spent by a block, are evicted, along with the ones
+// spending their outputs.
+func (m Mempool) Entries() []MempoolEntry {
+	var entries []MempoolEntry
+
+	err := m.Blockchain.db.Update(func(tx StoreTx) error {
+		tip := getHeader(tx, tx.Tip())
+		medianTime := medianTimePast(tx, tip)
+
+		// Evicting a transaction orphans the ones spending its outputs, the
+		// bucket is scanned again until nothing is evicted
+		for {
+			var evicted [][]byte
+			entries = nil
+
+			err := tx.ForEach(mempoolBucket, func(k, v []byte) error {
+				transaction, err := DeserializeTransaction(v)
+				if err != nil {
+					return err
+				}
+
+				fee, _, err := pendingInputs(tx, transaction)
+				if err != nil {
+					evicted = append(evicted, transaction.ID)
+					return nil
+				}
+				final := transaction.IsFinal(tip.Height+1, medianTime)
+				entries = append(entries, MempoolEntry{transaction, fee, final})
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if len(evicted) == 0 {
+				return nil
+			}
+
+			for _, txID := range evicted {
+				err := tx.Delete(mempoolBucket, txID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return FeeRate(entries[i].Fee, entries[i].Transaction.Size()) > FeeRate(entries[j].Fee, entries[j].Transaction.Size())
+	})
+
+	return parentsFirst(entries)
+}
+
+// Transactions returns the pending transactions that can be mined in the next
+// block, the highest fee rate first. A transaction spending outputs of pending
+// transactions comes after them, and is left out when any of them can't be
+// mined yet.
+func (m Mempool) Transactions() []*Transaction {
+	var transactions []*Transaction
+	entries := m.Entries()
+
+	pending := make(map[string]bool)
+	for _, entry := range entries {
+		pending[hex.EncodeToString(entry.Transaction.ID)] = true
+	}
+
+	included := make(map[string]bool)
+	for _, entry := range entries {
+		if !entry.Final {
+			continue
+		}
+
+		ready := true
+		for _, vin := range entry.Transaction.Vin {
+			parentID := hex.EncodeToString(vin.Txid)
+			if pending[parentID] && !included[parentID] {
+				ready = false
+				break
+			}
+		}
+
+		if ready {
+			transactions = append(transactions, entry.Transaction)
+			included[hex.EncodeToString(entry.Transaction.ID)] = true
+		}
+	}
+
+	return transactions
+}
+
+// parentsFirst reorders entries so that each comes after the entries it spends
+// outputs of, and otherwise keeps their order
+func parentsFirst(entries []MempoolEntry) []MempoolEntry {
+	remaining := make(map[string]bool)
+	for _, entry := range entries {
+		remaining[hex.EncodeToString(entry.Transaction.ID)] = true
+	}
+
+	ordered := make([]MempoolEntry, 0, len(entries))
+	for len(ordered) < len(entries) {
+		for _, entry := range entries {
+			txID := hex.EncodeToString(entry.Transaction.ID)
+			if !remaining[txID] {
+				continue
+			}
+
+			ready := true
+			for _, vin := range entry.Transaction.Vin {
+				if remaining[hex.EncodeToString(vin.Txid)] {
+					ready = false
+					break
+				}
+			}
+
+			// Each round places the first entry whose parents are all
+			// placed, a child waits for its parents and then takes its place
+			// by fee rate again
+			if ready {
+				ordered = append(ordered, entry)
+				delete(remaining, txID)
+				break
+			}
+		}
+	}
+
+	return ordered
+}
+
+// pendingSpends returns the outputs spent by the pending transactions
+func pendingSpends(tx StoreTx) (map[string]bool, error) {
+	spends := make(map[string]bool)
+
+	err := tx.ForEach(mempoolBucket, func(k, v []byte) error {
+		transaction, err := DeserializeTransaction(v)
+		if err != nil {
+			return err
+		}
+
+		for _, vin := range transaction.Vin {
+			spends[outpointKey(vin.Txid, vin.Vout)] = true
+		}
+
+		return nil
+	})
+
+	return spends, err
+}
+
+// pendingInputs checks that the inputs of a pending transaction spend distinct
+// outputs of the best chain that are spendable in the next block, or outputs
+// of other pending transactions. It returns the fee of the transaction and the
+// spent outputs, in the order of its inputs.
+func pendingInputs(tx StoreTx, transaction *Transaction) (int, []TXOutput, error) {
+	nextHeight := getHeader(tx, tx.Tip()).Height + 1
+	seen := make(map[string]bool)
+	var spent []TXOutput
+	inValue := 0
+
+	for _, vin := range transaction.Vin {
+		key := outpointKey(vin.Txid, vin.Vout)
+		if seen[key] {
+			return 0, nil, fmt.Errorf("transaction %x spends output %x:%d twice", transaction.ID, vin.Txid, vin.Vout)
+		}
+		seen[key] = true
+
+		var outs TXOutputs
+		if data := tx.Get(utxoBucket, vin.Txid); data != nil {
+			outs = DeserializeOutputs(data)
+		} else if data := tx.Get(mempoolBucket, vin.Txid); data != nil {
+			parent, err := DeserializeTransaction(data)
+			if err != nil {
+				return 0, nil, err
+			}
+			outs = NewTXOutputs(parent, nextHeight)
+		}
+
+		out, ok := outs.Outputs[vin.Vout]
+		if !ok {
+			return 0, nil, fmt.Errorf("output %x:%d is not found or already spent", vin.Txid, vin.Vout)
+		}
+		if !outs.IsMature(nextHeight) {
+			return 0, nil, fmt.Errorf("output %x:%d of the coinbase of height %d is not mature", vin.Txid, vin.Vout, outs.Height)
+		}
+
+		spent = append(spent, out)
+		inValue += out.Value
+	}
+
+	return inValue - transaction.OutputValue(), spent, nil
+}
+
+// removeFromMempool drops the pending transactions a newly connected block
+// includes or conflicts with. It runs inside the store transaction that
+// connects the block.
+func removeFromMempool(tx StoreTx, block *Block) error {
+	if !tx.HasBucket(mempoolBucket) {
+		return nil
+	}
+
+	spends := make(map[string]bool)
+	for _, btx := range block.Transactions {
+		for _, vin := range btx.Vin {
+			spends[outpointKey(vin.Txid, vin.Vout)] = true
+		}
+	}
+
+	var removed [][]byte
+	err := tx.ForEach(mempoolBucket, func(k, v []byte) error {
+		transaction, err := DeserializeTransaction(v)
+		if err != nil {
+			return err
+		}
+
+		for _, vin := range transaction.Vin {
+			if spends[outpointKey(vin.Txid, vin.Vout)] {
+				removed = append(removed, transaction.ID)
+				break
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, txID := range removed {
+		err := tx.Delete(mempoolBucket, txID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
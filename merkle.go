@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// Leaves and inner nodes of a Merkle tree are hashed with different prefixes,
+// so an inner node can't be passed off as a transaction
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+func merkleLeafHash(data []byte) []byte {
+	hash := sha256.Sum256(append([]byte{merkleLeafPrefix}, data...))
+
+	return hash[:]
+}
+
+func merkleNodeHash(left, right []byte) []byte {
+	data := append([]byte{merkleNodePrefix}, left...)
+	hash := sha256.Sum256(append(data, right...))
+
+	return hash[:]
+}
+
+// MerkleTree holds the levels of a Merkle tree, from the hashed leaves up to
+// the root. A node without a sibling is moved up a level as it is, instead of
+// being paired with a copy of itself, so two lists of leaves can't share a root.
+type MerkleTree struct {
+	levels [][][]byte
+}
+
+// NewMerkleTree builds the Merkle tree of the given leaves
+func NewMerkleTree(data [][]byte) *MerkleTree {
+	var level [][]byte
+
+	for _, datum := range data {
+		level = append(level, merkleLeafHash(datum))
+	}
+	if len(level) == 0 {
+		level = append(level, merkleLeafHash(nil))
+	}
+
+	tree := &MerkleTree{[][][]byte{level}}
+
+	for len(level) > 1 {
+		var next [][]byte
+
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, merkleNodeHash(level[i], level[i+1]))
+			}
+		}
+
+		tree.levels = append(tree.levels, next)
+		level = next
+	}
+
+	return tree
+}
+
+// Root returns the root hash of the tree
+func (t *MerkleTree) Root() []byte {
+	return t.levels[len(t.levels)-1][0]
+}
+
+// Branch returns the sibling hashes linking the leaf at index to the root,
+// from the bottom up. Levels where the node has no sibling contribute nothing.
+func (t *MerkleTree) Branch(index int) [][]byte {
+	var branch [][]byte
+
+	for _, level := range t.levels[:len(t.levels)-1] {
+		if index%2 == 1 {
+			branch = append(branch, level[index-1])
+		} else if index+1 < len(level) {
+			branch = append(branch, level[index+1])
+		}
+		index /= 2
+	}
+
+	return branch
+}
+
+// merkleRootFromBranch computes the root of a tree of count leaves from the
+// leaf at index and its branch
+func merkleRootFromBranch(data []byte, index, count int, branch [][]byte) ([]byte, error) {
+	if index < 0 || index >= count {
+		return nil, fmt.Errorf("leaf %d is out of a tree of %d leaves", index, count)
+	}
+
+	hash := merkleLeafHash(data)
+
+	for ; count > 1; index, count = index/2, (count+1)/2 {
+		if index%2 == 0 && index+1 == count {
+			continue
+		}
+
+		if len(branch) == 0 {
+			return nil, errors.New("merkle branch is too short")
+		}
+
+		if index%2 == 1 {
+			hash = merkleNodeHash(branch[0], hash)
+		} else {
+			hash = merkleNodeHash(hash, branch[0])
+		}
+		branch = branch[1:]
+	}
+
+	if len(branch) != 0 {
+		return nil, errors.New("merkle branch is too long")
+	}
+
+	return hash, nil
+}
+
+// merkleProofVersion is the version of the binary layout of merkle proofs
+const merkleProofVersion = 1
+
+// MerkleProof shows that a transaction is included in a block without the
+// other transactions of the block. Its leaf is the hash of the transaction,
+// signatures included, so the transaction itself is part of the proof.
+type MerkleProof struct {
+	Header      BlockHeader
+	Transaction *Transaction
+	Index       int
+	TxCount     int
+	Branch      [][]byte
+}
+
+// NewMerkleProof builds the proof of the transaction at index in the block
+func NewMerkleProof(block *Block, index int) (*MerkleProof, error) {
+	if block.Version == legacyHeaderVersion {
+		return nil, fmt.Errorf("block %x predates merkle transaction roots", block.Hash)
+	}
+
+	tree := NewMerkleTree(block.transactionHashes())
+
+	proof := &MerkleProof{
+		Header:      *block.Header(),
+		Transaction: block.Transactions[index],
+		Index:       index,
+		TxCount:     len(block.Transactions),
+		Branch:      tree.Branch(index),
+	}
+
+	return proof, nil
+}
+
+// Verify checks the seal of the header with engine and that the transaction,
+// through the branch, hashes to the transactions root of the header
+func (p *MerkleProof) Verify(engine Engine) error {
+	if p.Header.Version == legacyHeaderVersion {
+		return fmt.Errorf("block %x predates merkle transaction roots", p.Header.Hash)
+	}
+
+	err := engine.VerifySeal(&p.Header)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Compare(p.Transaction.ID, p.Transaction.UnsignedHash()) != 0 {
+		return fmt.Errorf("transaction %x doesn't match its hash", p.Transaction.ID)
+	}
+
+	root, err := merkleRootFromBranch(p.Transaction.Hash(), p.Index, p.TxCount, p.Branch)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Compare(root, p.Header.TxRoot) != 0 {
+		return errors.New("transaction isn't included in the block")
+	}
+
+	return nil
+}
+
+// Encode writes the proof: a uint32 version, the block header and the
+// transaction in their layouts, uint32 Index and TxCount, then the branch as a
+// uint32 count of bytes
+func (p *MerkleProof) Encode(w io.Writer) error {
+	e := &encoder{w: w}
+
+	e.uint32(merkleProofVersion)
+	if e.err != nil {
+		return e.err
+	}
+
+	err := p.Header.Encode(w)
+	if err != nil {
+		return err
+	}
+
+	err = p.Transaction.Encode(w)
+	if err != nil {
+		return err
+	}
+
+	e.uint32(uint32(p.Index))
+	e.uint32(uint32(p.TxCount))
+	e.count(len(p.Branch))
+	for _, hash := range p.Branch {
+		e.bytes(hash)
+	}
+
+	return e.err
+}
+
+// DecodeMerkleProof reads a proof written by Encode
+func DecodeMerkleProof(r io.Reader) (*MerkleProof, error) {
+	d := &decoder{r: r}
+	proof := MerkleProof{}
+
+	version := d.uint32()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if version != merkleProofVersion {
+		return nil, fmt.Errorf("unsupported merkle proof version %d", version)
+	}
+
+	header, err := DecodeBlockHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	proof.Header = *header
+
+	proof.Transaction, err = DecodeTransaction(r)
+	if err != nil {
+		return nil, err
+	}
+
+	proof.Index = int(d.uint32())
+	proof.TxCount = int(d.uint32())
+	n := d.count()
+	for i := 0; i < n && d.err == nil; i++ {
+		proof.Branch = append(proof.Branch, d.bytes())
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return &proof, nil
+}
+
+// Serialize serializes the proof
+func (p *MerkleProof) Serialize() []byte {
+	var result bytes.Buffer
+
+	err := p.Encode(&result)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return result.Bytes()
+}
+
+// DeserializeMerkleProof deserializes a proof
+func DeserializeMerkleProof(data []byte) (*MerkleProof, error) {
+	var proof *MerkleProof
+
+	err := decodeAll(data, func(r io.Reader) error {
+		var err error
+		proof, err = DecodeMerkleProof(r)
+
+		return err
+	})
+	if err != nil {
+		return nil, errors.New("invalid merkle proof: " + err.Error())
+	}
+
+	return proof, nil
+}
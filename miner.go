@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// nonceRangeSize is the number of nonces a worker takes at a time. It keeps
+// the workers from contending for the job while bounding how long a worker
+// runs before noticing a cancellation.
+const nonceRangeSize = 1 << 16
+
+// hashRateInterval is the time between two hash rate reports
+const hashRateInterval = 2 * time.Second
+
+// Miner searches for proofs-of-work on several worker goroutines
+type Miner struct {
+	workers int
+}
+
+// NewMiner returns a Miner running the given number of workers, or one per
+// CPU when workers is 0
+func NewMiner(workers int) *Miner {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	return &Miner{workers}
+}
+
+// miningJob hands out nonce ranges of a header to the workers. Once every
+// nonce of the header has been handed out, its timestamp is rolled forward and
+// the nonces start over.
+type miningJob struct {
+	mu     sync.Mutex
+	header BlockHeader
+	next   int
+}
+
+// nextRange returns a copy of the header to mine and a range of its nonces
+func (j *miningJob) nextRange() (BlockHeader, int, int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.next >= maxNonce {
+		j.header.Timestamp++
+		if now := time.Now().Unix(); now > j.header.Timestamp {
+			j.header.Timestamp = now
+		}
+		j.next = 0
+	}
+
+	start := j.next
+	end := start + nonceRangeSize
+	if end > maxNonce || end < start {
+		end = maxNonce
+	}
+	j.next = end
+
+	return j.header, start, end
+}
+
+// Mine searches for a nonce giving the header a hash below its target and
+// sets the Nonce and Hash of the header, as well as its Timestamp when it had
+// to be rolled. The hash rate is printed periodically. Mine stops with the
+// error of ctx when ctx is done before a nonce is found.
+func (m *Miner) Mine(ctx context.Context, header *BlockHeader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	job := &miningJob{header: *header}
+	found := make(chan BlockHeader, m.workers)
+	var hashes int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < m.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.work(ctx, job, found, &hashes)
+		}()
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(hashRateInterval)
+	defer ticker.Stop()
+
+	fmt.Printf("Mining a new block, workers: %d", m.workers)
+	for {
+		select {
+		case mined := <-found:
+			cancel()
+			wg.Wait()
+
+			*header = mined
+			elapsed := time.Since(start)
+			fmt.Printf("\r%x\n%d hashes in %s\n\n", mined.Hash, atomic.LoadInt64(&hashes), elapsed.Round(time.Millisecond))
+
+			return nil
+		case <-ctx.Done():
+			wg.Wait()
+			fmt.Print("\n\n")
+
+			return ctx.Err()
+		case <-ticker.C:
+			rate := float64(atomic.LoadInt64(&hashes)) / time.Since(start).Seconds()
+			fmt.Printf("\rMining a new block, workers: %d, %.0f hashes/s", m.workers, rate)
+		}
+	}
+}
+
+// work searches the nonce ranges of the job until a nonce is found or ctx is done
+func (m *Miner) work(ctx context.Context, job *miningJob, found chan<- BlockHeader, hashes *int64) {
+	for ctx.Err() == nil {
+		header, start, end := job.nextRange()
+
+		nonce, hash, n, ok := NewHeaderProofOfWork(&header).searchRange(start, end)
+		atomic.AddInt64(hashes, int64(n))
+
+		if ok {
+			header.Nonce = nonce
+			header.Hash = hash
+			found <- header
+
+			return
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+// ChainParams holds the values that define a network. Chains and addresses of
+// different networks can't be mixed: each network has its own genesis block,
+// address version and data directory.
+type ChainParams struct {
+	Name string
+
+	// AddressVersion is the first byte of the addresses of the network
+	AddressVersion byte
+
+	// ScriptAddressVersion is the first byte of the addresses of scripts,
+	// which outputs pay to with a pay-to-script-hash script
+	ScriptAddressVersion byte
+
+	// GenesisCoinbaseData is the data of the genesis block coinbase, which
+	// tells the genesis blocks of the networks apart
+	GenesisCoinbaseData string
+
+	// TargetBits is the difficulty of the genesis block. Without NoRetarget,
+	// the difficulty is then adjusted every retargetInterval blocks.
+	TargetBits int
+	NoRetarget bool
+
+	Emission EmissionSchedule
+
+	// CoinbaseMaturity is the number of blocks that must follow a block before
+	// the outputs of its coinbase can be spent, so rewards of blocks that may
+	// still be orphaned can't be passed on
+	CoinbaseMaturity int
+
+	// DataSubdir is where the network keeps its files in the data directory
+	DataSubdir string
+}
+
+// mainnetParams are the parameters of the main network, whose data stays at
+// the root of the data directory
+var mainnetParams = ChainParams{
+	Name:                 "mainnet",
+	AddressVersion:       0x00,
+	ScriptAddressVersion: 0x05,
+	GenesisCoinbaseData:  "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks",
+	TargetBits:           24,
+	Emission:             EmissionSchedule{InitialSubsidy: 10, HalvingInterval: 210000},
+	CoinbaseMaturity:     10,
+	DataSubdir:           "",
+}
+
+// testnetParams are the parameters of the test network, a public network
+// mined at a lower difficulty
+var testnetParams = ChainParams{
+	Name:                 "testnet",
+	AddressVersion:       0x6f,
+	ScriptAddressVersion: 0xc4,
+	GenesisCoinbaseData:  "Testnet genesis block",
+	TargetBits:           16,
+	Emission:             EmissionSchedule{InitialSubsidy: 10, HalvingInterval: 210000},
+	CoinbaseMaturity:     10,
+	DataSubdir:           "testnet",
+}
+
+// regtestParams are the parameters of the regression test network, a local
+// network whose blocks are mined instantly and which halves its subsidy often
+var regtestParams = ChainParams{
+	Name:                 "regtest",
+	AddressVersion:       0x7a,
+	ScriptAddressVersion: 0x7d,
+	GenesisCoinbaseData:  "Regtest genesis block",
+	TargetBits:           1,
+	NoRetarget:           true,
+	Emission:             EmissionSchedule{InitialSubsidy: 10, HalvingInterval: 150},
+	CoinbaseMaturity:     10,
+	DataSubdir:           "regtest",
+}
+
+// networks are the known networks by name
+var networks = map[string]*ChainParams{
+	mainnetParams.Name: &mainnetParams,
+	testnetParams.Name: &testnetParams,
+	regtestParams.Name: &regtestParams,
+}
+
+// activeParams are the parameters of the network the node runs on
+var activeParams = &mainnetParams
@@ -3,7 +3,7 @@ package main
 import (
 	"bytes"
 	"crypto/sha256"
-	"fmt"
+	"encoding/binary"
 	"math"
 	"math/big"
 )
@@ -12,73 +12,72 @@ var (
 	maxNonce = math.MaxInt64
 )
 
-const targetBits = 24
-
 // ProofOfWork represents a proof-of-work
 type ProofOfWork struct {
-	block  *Block
+	header *BlockHeader
 	target *big.Int
 }
 
 // NewProofOfWork builds and returns a ProofOfWork
 func NewProofOfWork(b *Block) *ProofOfWork {
+	return NewHeaderProofOfWork(b.Header())
+}
+
+// NewHeaderProofOfWork builds and returns a ProofOfWork for a block header
+func NewHeaderProofOfWork(h *BlockHeader) *ProofOfWork {
 	target := big.NewInt(1)
-	target.Lsh(target, uint(256-targetBits))
+	target.Lsh(target, uint(256-effectiveBits(h.Bits)))
 
-	pow := &ProofOfWork{b, target}
+	pow := &ProofOfWork{h, target}
 
 	return pow
 }
 
 func (pow *ProofOfWork) prepareData(nonce int) []byte {
-	data := bytes.Join(
-		[][]byte{
-			pow.block.PrevBlockHash,
-			pow.block.HashTransactions(),
-			IntToHex(pow.block.Timestamp),
-			IntToHex(int64(targetBits)),
-			IntToHex(int64(nonce)),
-		},
-		[]byte{},
-	)
-
-	return data
+	return pow.header.hashData(nonce)
 }
 
-// Run performs a proof-of-work
-func (pow *ProofOfWork) Run() (int, []byte) {
+// searchRange tries the nonces from start up to end and returns the first one
+// meeting the target. The header is laid out once, only the nonce at its end
+// changes between attempts. The number of hashes computed is returned too.
+func (pow *ProofOfWork) searchRange(start, end int) (nonce int, hash []byte, hashes int, found bool) {
 	var hashInt big.Int
-	var hash [32]byte
-	nonce := 0
 
-	fmt.Printf("Mining a new block")
-	for nonce < maxNonce {
-		data := pow.prepareData(nonce)
+	data := pow.prepareData(start)
+	nonceBytes := data[len(data)-8:]
+
+	for nonce = start; nonce < end; nonce++ {
+		binary.BigEndian.PutUint64(nonceBytes, uint64(nonce))
 
-		hash = sha256.Sum256(data)
-		fmt.Printf("\r%x", hash)
-		hashInt.SetBytes(hash[:])
+		sum := sha256.Sum256(data)
+		hashInt.SetBytes(sum[:])
 
 		if hashInt.Cmp(pow.target) == -1 {
-			break
-		} else {
-			nonce++
+			return nonce, sum[:], nonce - start + 1, true
 		}
 	}
-	fmt.Print("\n\n")
 
-	return nonce, hash[:]
+	return 0, nil, end - start, false
 }
 
 // Validate validates block's PoW
 func (pow *ProofOfWork) Validate() bool {
 	var hashInt big.Int
 
-	data := pow.prepareData(pow.block.Nonce)
+	data := pow.prepareData(pow.header.Nonce)
 	hash := sha256.Sum256(data)
 	hashInt.SetBytes(hash[:])
 
-	isValid := hashInt.Cmp(pow.target) == -1
+	isValid := hashInt.Cmp(pow.target) == -1 && bytes.Compare(hash[:], pow.header.Hash) == 0
 
 	return isValid
 }
+
+// Work returns the expected number of hashes needed to meet the target
+func (pow *ProofOfWork) Work() *big.Int {
+	// 2**256 / (target + 1)
+	work := big.NewInt(1)
+	work.Lsh(work, 256)
+
+	return work.Div(work, new(big.Int).Add(pow.target, big.NewInt(1)))
+}
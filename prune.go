@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+const headersBucket = "headers"
+
+// prunedHeightKey keeps the height of the first best chain block whose body is
+// still stored. The key is shorter than a block hash, so it can't clash with one.
+var prunedHeightKey = []byte("p")
+
+// getHeader returns the header of a stored block, whether its body is pruned or not
+func getHeader(tx StoreTx, hash []byte) *BlockHeader {
+	if block := tx.GetBlock(hash); block != nil {
+		return block.Header()
+	}
+
+	data := tx.Get(headersBucket, hash)
+	if data == nil {
+		return nil
+	}
+
+	header, err := DeserializeBlockHeader(data)
+	if err != nil {
+		log.Panic(fmt.Errorf("block %x: %s", hash, err))
+	}
+
+	return header
+}
+
+// getFullBlock returns a stored block with its transactions. It fails with a
+// "block pruned" error when only the header of the block is kept.
+func getFullBlock(tx StoreTx, hash []byte) (*Block, error) {
+	if block := tx.GetBlock(hash); block != nil {
+		return block, nil
+	}
+
+	if tx.Get(headersBucket, hash) != nil {
+		return nil, fmt.Errorf("block %x is pruned", hash)
+	}
+
+	return nil, errors.New("Block is not found")
+}
+
+// prunedHeight returns the number of best chain blocks whose bodies are pruned
+func prunedHeight(tx StoreTx) int {
+	data := tx.Get(headersBucket, prunedHeightKey)
+	if data == nil {
+		return 0
+	}
+
+	return int(HexToInt(data))
+}
+
+// pruneBlocks replaces the bodies of the best chain blocks more than depth
+// blocks below the tip by their headers and drops their undo data. The UTXO
+// set already reflects those blocks, so only lookups of their transactions and
+// reorganizations below them are lost.
+func pruneBlocks(tx StoreTx, depth int) error {
+	tip := tx.GetBlock(tx.Tip())
+	limit := tip.Height - depth
+
+	from := prunedHeight(tx)
+	if from > limit {
+		return nil
+	}
+
+	err := tx.CreateBucket(headersBucket)
+	if err != nil {
+		return err
+	}
+
+	for height := from; height <= limit; height++ {
+		hash := tx.Get(heightsBucket, IntToHex(int64(height)))
+		block := tx.GetBlock(hash)
+		if block == nil {
+			return fmt.Errorf("block %d %x is missing", height, hash)
+		}
+
+		err = tx.Put(headersBucket, block.Hash, block.Header().Serialize())
+		if err != nil {
+			return err
+		}
+
+		err = tx.Delete(blocksBucket, block.Hash)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Delete(undoBucket, block.Hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Put(headersBucket, prunedHeightKey, IntToHex(int64(limit+1)))
+}
+
+// PrunedHeight returns the height of the first best chain block that still has its transactions
+func (bc *Blockchain) PrunedHeight() int {
+	height := 0
+
+	err := bc.db.View(func(tx StoreTx) error {
+		height = prunedHeight(tx)
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return height
+}
+
+// GetBlockHeader finds a block by its hash and returns its header, also for pruned blocks
+func (bc *Blockchain) GetBlockHeader(blockHash []byte) (BlockHeader, error) {
+	var header BlockHeader
+
+	err := bc.db.View(func(tx StoreTx) error {
+		h := getHeader(tx, blockHash)
+		if h == nil {
+			return errors.New("Block is not found")
+		}
+		header = *h
+
+		return nil
+	})
+
+	return header, err
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Opcodes of the script language, numbered as in Bitcoin. Opcodes up to
+// opPushData4 push data, op1 to op16 push the numbers 1 to 16.
+const (
+	op0              = 0x00
+	opPushData1      = 0x4c // the next byte is the length of the data
+	opPushData2      = 0x4d // the next 2 bytes, little-endian, are the length of the data
+	opPushData4      = 0x4e // the next 4 bytes, little-endian, are the length of the data
+	op1              = 0x51
+	op16             = 0x60
+	opIf             = 0x63
+	opNotIf          = 0x64
+	opElse           = 0x67
+	opEndIf          = 0x68
+	opVerify         = 0x69
+	opReturn         = 0x6a
+	op2Drop          = 0x6d
+	op2Dup           = 0x6e
+	opDepth          = 0x74
+	opDrop           = 0x75
+	opDup            = 0x76
+	opNip            = 0x77
+	opOver           = 0x78
+	opSwap           = 0x7c
+	opEqual          = 0x87
+	opEqualVerify    = 0x88
+	opSHA256         = 0xa8
+	opHash160        = 0xa9
+	opCheckSig       = 0xac
+	opCheckSigVerify = 0xad
+	// OP_CHECKMULTISIG takes the signatures, their count, the public keys
+	// and their count, with no extra element unlike in Bitcoin
+	opCheckMultiSig       = 0xae
+	opCheckMultiSigVerify = 0xaf
+)
+
+// opcodeNames are the names of the opcodes the interpreter knows
+var opcodeNames = map[byte]string{
+	op0:                   "OP_0",
+	opIf:                  "OP_IF",
+	opNotIf:               "OP_NOTIF",
+	opElse:                "OP_ELSE",
+	opEndIf:               "OP_ENDIF",
+	opVerify:              "OP_VERIFY",
+	opReturn:              "OP_RETURN",
+	op2Drop:               "OP_2DROP",
+	op2Dup:                "OP_2DUP",
+	opDepth:               "OP_DEPTH",
+	opDrop:                "OP_DROP",
+	opDup:                 "OP_DUP",
+	opNip:                 "OP_NIP",
+	opOver:                "OP_OVER",
+	opSwap:                "OP_SWAP",
+	opEqual:               "OP_EQUAL",
+	opEqualVerify:         "OP_EQUALVERIFY",
+	opSHA256:              "OP_SHA256",
+	opHash160:             "OP_HASH160",
+	opCheckSig:            "OP_CHECKSIG",
+	opCheckSigVerify:      "OP_CHECKSIGVERIFY",
+	opCheckMultiSig:       "OP_CHECKMULTISIG",
+	opCheckMultiSigVerify: "OP_CHECKMULTISIGVERIFY",
+}
+
+// scriptInstruction is an opcode of a script with the data it pushes
+type scriptInstruction struct {
+	op   byte
+	data []byte
+}
+
+// isPush reports whether the instruction only pushes data or a number
+func (in scriptInstruction) isPush() bool {
+	return in.op <= opPushData4 || in.op >= op1 && in.op <= op16
+}
+
+// parseScript splits a script into its instructions
+func parseScript(script []byte) ([]scriptInstruction, error) {
+	var instructions []scriptInstruction
+
+	for i := 0; i < len(script); {
+		op := script[i]
+		i++
+
+		n := 0
+		switch {
+		case op < opPushData1:
+			n = int(op)
+		case op == opPushData1 && i+1 <= len(script):
+			n = int(script[i])
+			i++
+		case op == opPushData2 && i+2 <= len(script):
+			n = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		case op == opPushData4 && i+4 <= len(script):
+			n = int(binary.LittleEndian.Uint32(script[i:]))
+			i += 4
+		case op <= opPushData4:
+			return nil, fmt.Errorf("push at offset %d is truncated", i-1)
+		}
+
+		if n < 0 || n > len(script)-i {
+			return nil, fmt.Errorf("push at offset %d is truncated", i-1)
+		}
+
+		instructions = append(instructions, scriptInstruction{op, script[i : i+n]})
+		i += n
+	}
+
+	return instructions, nil
+}
+
+// appendPush appends an instruction pushing data to a script
+func appendPush(script, data []byte) []byte {
+	n := len(data)
+
+	switch {
+	case n < opPushData1:
+		script = append(script, byte(n))
+	case n <= 0xff:
+		script = append(script, opPushData1, byte(n))
+	case n <= 0xffff:
+		script = append(script, opPushData2, 0, 0)
+		binary.LittleEndian.PutUint16(script[len(script)-2:], uint16(n))
+	default:
+		script = append(script, opPushData4, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(script[len(script)-4:], uint32(n))
+	}
+
+	return append(script, data...)
+}
+
+// appendNumber appends an instruction pushing a number from 0 to 16
+func appendNumber(script []byte, n int) []byte {
+	if n == 0 {
+		return append(script, op0)
+	}
+
+	return append(script, byte(op1+n-1))
+}
+
+// pushedData returns the data pushed by a script made of data pushes only
+func pushedData(script []byte) ([][]byte, bool) {
+	instructions, err := parseScript(script)
+	if err != nil {
+		return nil, false
+	}
+
+	var data [][]byte
+	for _, in := range instructions {
+		if in.op > opPushData4 {
+			return nil, false
+		}
+		data = append(data, in.data)
+	}
+
+	return data, true
+}
+
+// NewP2PKHScript returns the pay-to-pubkey-hash script locking an output to
+// the owner of the public key hashed into pubKeyHash:
+//
+//	OP_DUP OP_HASH160 <pubKeyHash> OP_EQUALVERIFY OP_CHECKSIG
+func NewP2PKHScript(pubKeyHash []byte) []byte {
+	script := []byte{opDup, opHash160}
+	script = appendPush(script, pubKeyHash)
+
+	return append(script, opEqualVerify, opCheckSig)
+}
+
+// NewP2PKHUnlockingScript returns the script spending a pay-to-pubkey-hash
+// output: <signature> <pubKey>
+func NewP2PKHUnlockingScript(signature, pubKey []byte) []byte {
+	return appendPush(appendPush(nil, signature), pubKey)
+}
+
+// extractP2PKH returns the public key hash a pay-to-pubkey-hash script locks
+// an output to
+func extractP2PKH(script []byte) ([]byte, bool) {
+	instructions, err := parseScript(script)
+	if err != nil || len(instructions) != 5 {
+		return nil, false
+	}
+
+	if instructions[0].op != opDup || instructions[1].op != opHash160 || instructions[2].op > opPushData4 ||
+		instructions[3].op != opEqualVerify || instructions[4].op != opCheckSig {
+		return nil, false
+	}
+
+	pubKeyHash := instructions[2].data
+	if !bytes.Equal(NewP2PKHScript(pubKeyHash), script) {
+		return nil, false
+	}
+
+	return pubKeyHash, true
+}
+
+// extractP2PKHUnlocking returns the signature and public key of a script
+// spending a pay-to-pubkey-hash output. An empty script has neither.
+func extractP2PKHUnlocking(script []byte) ([]byte, []byte, bool) {
+	if len(script) == 0 {
+		return nil, nil, true
+	}
+
+	data, ok := pushedData(script)
+	if !ok || len(data) != 2 || !bytes.Equal(NewP2PKHUnlockingScript(data[0], data[1]), script) {
+		return nil, nil, false
+	}
+
+	return data[0], data[1], true
+}
+
+// NewMultisigScript returns the script locking an output to any m of the
+// public keys, whose signatures must be given in the order of their keys:
+//
+//	OP_m <pubKey 1> ... <pubKey n> OP_n OP_CHECKMULTISIG
+func NewMultisigScript(m int, pubKeys [][]byte) []byte {
+	script := appendNumber(nil, m)
+	for _, pubKey := range pubKeys {
+		script = appendPush(script, pubKey)
+	}
+	script = appendNumber(script, len(pubKeys))
+
+	return append(script, opCheckMultiSig)
+}
+
+// extractMultisig returns the number of signatures a multisig script requires
+// and its public keys
+func extractMultisig(script []byte) (int, [][]byte, bool) {
+	instructions, err := parseScript(script)
+	if err != nil || len(instructions) < 3 || len(instructions)-3 > maxMultisigKeys {
+		return 0, nil, false
+	}
+
+	first := instructions[0]
+	if first.op < op1 || first.op > op16 {
+		return 0, nil, false
+	}
+	m := int(first.op-op1) + 1
+
+	var pubKeys [][]byte
+	for _, in := range instructions[1 : len(instructions)-2] {
+		pubKeys = append(pubKeys, in.data)
+	}
+
+	if m > len(pubKeys) || !bytes.Equal(NewMultisigScript(m, pubKeys), script) {
+		return 0, nil, false
+	}
+
+	return m, pubKeys, true
+}
+
+// NewMultisigUnlockingScript returns the script spending a multisig
+// pay-to-script-hash output: <signature 1> ... <signature m> <redeemScript>.
+// Without signatures it only carries the redeem script to the signers.
+func NewMultisigUnlockingScript(signatures [][]byte, redeemScript []byte) []byte {
+	var script []byte
+	for _, signature := range signatures {
+		script = appendPush(script, signature)
+	}
+
+	return appendPush(script, redeemScript)
+}
+
+// extractMultisigUnlocking returns the signatures and the redeem script of a
+// script spending a multisig pay-to-script-hash output
+func extractMultisigUnlocking(script []byte) ([][]byte, []byte, bool) {
+	data, ok := pushedData(script)
+	if !ok || len(data) == 0 {
+		return nil, nil, false
+	}
+
+	signatures, redeemScript := data[:len(data)-1], data[len(data)-1]
+	if _, _, ok := extractMultisig(redeemScript); !ok {
+		return nil, nil, false
+	}
+	if !bytes.Equal(NewMultisigUnlockingScript(signatures, redeemScript), script) {
+		return nil, nil, false
+	}
+
+	return signatures, redeemScript, true
+}
+
+// NewP2SHScript returns the pay-to-script-hash script locking an output to
+// whoever reveals the script hashed into scriptHash and satisfies it:
+//
+//	OP_HASH160 <scriptHash> OP_EQUAL
+func NewP2SHScript(scriptHash []byte) []byte {
+	script := appendPush([]byte{opHash160}, scriptHash)
+
+	return append(script, opEqual)
+}
+
+// extractP2SH returns the script hash a pay-to-script-hash script locks an
+// output to
+func extractP2SH(script []byte) ([]byte, bool) {
+	instructions, err := parseScript(script)
+	if err != nil || len(instructions) != 3 {
+		return nil, false
+	}
+
+	scriptHash := instructions[1].data
+	if !bytes.Equal(NewP2SHScript(scriptHash), script) {
+		return nil, false
+	}
+
+	return scriptHash, true
+}
+
+// DisassembleScript returns a readable form of a script: opcode names with
+// pushed data in hex
+func DisassembleScript(script []byte) string {
+	instructions, err := parseScript(script)
+	if err != nil {
+		return fmt.Sprintf("[invalid script %x]", script)
+	}
+
+	var words []string
+	for _, in := range instructions {
+		switch {
+		case in.op == op0:
+			words = append(words, opcodeNames[op0])
+		case in.op <= opPushData4:
+			words = append(words, fmt.Sprintf("%x", in.data))
+		case in.op >= op1 && in.op <= op16:
+			words = append(words, fmt.Sprintf("OP_%d", in.op-op1+1))
+		case opcodeNames[in.op] != "":
+			words = append(words, opcodeNames[in.op])
+		default:
+			words = append(words, fmt.Sprintf("OP_UNKNOWN%d", in.op))
+		}
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Limits of the interpreter. They keep the execution of every script cheap
+// and bounded, whatever the script does.
+const (
+	maxScriptSize  = 10000
+	maxElementSize = 520
+	maxStackSize   = 1000
+	maxScriptOps   = 201
+
+	// maxMultisigKeys is the most public keys OP_CHECKMULTISIG takes, the
+	// largest count a single opcode pushes
+	maxMultisigKeys = 16
+)
+
+// signatureChecker verifies a signature by a public key of the input whose
+// scripts run
+type signatureChecker func(signature, pubKey []byte) bool
+
+// scriptEngine executes scripts on a stack. Execution is deterministic: it
+// only depends on the scripts and on the signature checker.
+type scriptEngine struct {
+	stack    [][]byte
+	checkSig signatureChecker
+}
+
+// verifyScripts runs the unlocking script of an input, which may only push
+// data, then the locking script of the output it spends on the resulting
+// stack. The input is valid when the locking script leaves true on top. When
+// the locking script is pay-to-script-hash, it only checks the hash of the
+// script the unlocking script pushed last: that redeem script then runs on
+// the rest of what the unlocking script pushed, and must leave true on top.
+func verifyScripts(scriptSig, scriptPubKey []byte, checkSig signatureChecker) error {
+	engine := &scriptEngine{checkSig: checkSig}
+
+	err := engine.execute(scriptSig, true)
+	if err != nil {
+		return fmt.Errorf("unlocking script: %s", err)
+	}
+	pushed := append([][]byte(nil), engine.stack...)
+
+	err = engine.execute(scriptPubKey, false)
+	if err == nil {
+		err = engine.checkResult()
+	}
+	if err != nil {
+		return fmt.Errorf("locking script: %s", err)
+	}
+
+	if _, ok := extractP2SH(scriptPubKey); !ok {
+		return nil
+	}
+
+	engine.stack = pushed
+	redeemScript, err := engine.pop()
+	if err == nil {
+		err = engine.execute(redeemScript, false)
+	}
+	if err == nil {
+		err = engine.checkResult()
+	}
+	if err != nil {
+		return fmt.Errorf("redeem script: %s", err)
+	}
+
+	return nil
+}
+
+// checkResult fails unless a script left true on top of the stack
+func (e *scriptEngine) checkResult() error {
+	if len(e.stack) == 0 || !asBool(e.stack[len(e.stack)-1]) {
+		return errors.New("script doesn't end with true")
+	}
+
+	return nil
+}
+
+// execute runs a script on the stack of the engine
+func (e *scriptEngine) execute(script []byte, pushOnly bool) error {
+	if len(script) > maxScriptSize {
+		return fmt.Errorf("script is %d bytes long, more than %d", len(script), maxScriptSize)
+	}
+
+	instructions, err := parseScript(script)
+	if err != nil {
+		return err
+	}
+
+	// Whether each enclosing conditional branch executes
+	var branches []bool
+	ops := 0
+
+	for _, in := range instructions {
+		if pushOnly && !in.isPush() {
+			return fmt.Errorf("%s is not a push", DisassembleScript([]byte{in.op}))
+		}
+
+		if len(in.data) > maxElementSize {
+			return fmt.Errorf("pushed element is %d bytes long, more than %d", len(in.data), maxElementSize)
+		}
+
+		if !in.isPush() {
+			ops++
+			if ops > maxScriptOps {
+				return fmt.Errorf("script has more than %d operations", maxScriptOps)
+			}
+		}
+
+		executing := true
+		for _, branch := range branches {
+			executing = executing && branch
+		}
+
+		switch in.op {
+		case opIf, opNotIf:
+			branch := false
+			if executing {
+				top, err := e.pop()
+				if err != nil {
+					return err
+				}
+				branch = asBool(top) == (in.op == opIf)
+			}
+			branches = append(branches, branch)
+
+			continue
+		case opElse:
+			if len(branches) == 0 {
+				return errors.New("OP_ELSE without OP_IF")
+			}
+			branches[len(branches)-1] = !branches[len(branches)-1]
+
+			continue
+		case opEndIf:
+			if len(branches) == 0 {
+				return errors.New("OP_ENDIF without OP_IF")
+			}
+			branches = branches[:len(branches)-1]
+
+			continue
+		}
+
+		if !executing {
+			continue
+		}
+
+		err := e.step(in)
+		if err != nil {
+			return err
+		}
+
+		if len(e.stack) > maxStackSize {
+			return fmt.Errorf("stack has more than %d elements", maxStackSize)
+		}
+	}
+
+	if len(branches) != 0 {
+		return errors.New("OP_IF without OP_ENDIF")
+	}
+
+	return nil
+}
+
+// step executes a single instruction outside of conditionals
+func (e *scriptEngine) step(in scriptInstruction) error {
+	switch {
+	case in.op <= opPushData4:
+		e.push(in.data)
+
+		return nil
+	case in.op >= op1 && in.op <= op16:
+		e.push(scriptNumber(int(in.op - op1 + 1)))
+
+		return nil
+	}
+
+	switch in.op {
+	case opVerify:
+		return e.verify()
+	case opReturn:
+		return errors.New("OP_RETURN executed")
+	case op2Drop:
+		if len(e.stack) < 2 {
+			return errors.New("stack has less than 2 elements")
+		}
+		e.stack = e.stack[:len(e.stack)-2]
+	case op2Dup:
+		if len(e.stack) < 2 {
+			return errors.New("stack has less than 2 elements")
+		}
+		e.push(e.stack[len(e.stack)-2])
+		e.push(e.stack[len(e.stack)-2])
+	case opDepth:
+		e.push(scriptNumber(len(e.stack)))
+	case opDrop:
+		_, err := e.pop()
+		return err
+	case opDup:
+		top, err := e.peek(0)
+		if err != nil {
+			return err
+		}
+		e.push(top)
+	case opNip:
+		if len(e.stack) < 2 {
+			return errors.New("stack has less than 2 elements")
+		}
+		e.stack = append(e.stack[:len(e.stack)-2], e.stack[len(e.stack)-1])
+	case opOver:
+		second, err := e.peek(1)
+		if err != nil {
+			return err
+		}
+		e.push(second)
+	case opSwap:
+		if len(e.stack) < 2 {
+			return errors.New("stack has less than 2 elements")
+		}
+		n := len(e.stack)
+		e.stack[n-1], e.stack[n-2] = e.stack[n-2], e.stack[n-1]
+	case opEqual, opEqualVerify:
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.push(fromBool(bytes.Equal(a, b)))
+
+		if in.op == opEqualVerify {
+			return e.verify()
+		}
+	case opSHA256:
+		top, err := e.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(top)
+		e.push(hash[:])
+	case opHash160:
+		top, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.push(HashPubKey(top))
+	case opCheckSig, opCheckSigVerify:
+		pubKey, err := e.pop()
+		if err != nil {
+			return err
+		}
+		signature, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.push(fromBool(len(signature) != 0 && e.checkSig(signature, pubKey)))
+
+		if in.op == opCheckSigVerify {
+			return e.verify()
+		}
+	case opCheckMultiSig, opCheckMultiSigVerify:
+		valid, err := e.checkMultiSig()
+		if err != nil {
+			return err
+		}
+		e.push(fromBool(valid))
+
+		if in.op == opCheckMultiSigVerify {
+			return e.verify()
+		}
+	default:
+		return fmt.Errorf("unknown opcode 0x%02x", in.op)
+	}
+
+	return nil
+}
+
+// checkMultiSig pops the public keys and their count, then the signatures and
+// their count, and checks that each signature is by a different key. The
+// signatures must be in the order of their keys, so each key is tried once and
+// a key can't sign twice.
+func (e *scriptEngine) checkMultiSig() (bool, error) {
+	n, err := e.popNumber()
+	if err != nil {
+		return false, err
+	}
+	if n < 0 || n > maxMultisigKeys {
+		return false, fmt.Errorf("%d public keys, more than %d", n, maxMultisigKeys)
+	}
+
+	pubKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		pubKeys[i], err = e.pop()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	m, err := e.popNumber()
+	if err != nil {
+		return false, err
+	}
+	if m < 0 || m > n {
+		return false, fmt.Errorf("%d signatures required of %d public keys", m, n)
+	}
+
+	signatures := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		signatures[i], err = e.pop()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	k := 0
+	for _, signature := range signatures {
+		for k < n && !(len(signature) != 0 && e.checkSig(signature, pubKeys[k])) {
+			k++
+		}
+		if k == n {
+			return false, nil
+		}
+		k++
+	}
+
+	return true, nil
+}
+
+func (e *scriptEngine) push(data []byte) {
+	e.stack = append(e.stack, data)
+}
+
+func (e *scriptEngine) pop() ([]byte, error) {
+	top, err := e.peek(0)
+	if err != nil {
+		return nil, err
+	}
+	e.stack = e.stack[:len(e.stack)-1]
+
+	return top, nil
+}
+
+// peek returns the element depth positions below the top of the stack
+func (e *scriptEngine) peek(depth int) ([]byte, error) {
+	if depth >= len(e.stack) {
+		return nil, errors.New("stack has too few elements")
+	}
+
+	return e.stack[len(e.stack)-1-depth], nil
+}
+
+// popNumber pops a number of at most 4 bytes encoded as scriptNumber does
+func (e *scriptEngine) popNumber() (int, error) {
+	top, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(top) > 4 {
+		return 0, fmt.Errorf("number is %d bytes long, more than 4", len(top))
+	}
+
+	n := 0
+	for i := len(top) - 1; i >= 0; i-- {
+		n = n<<8 | int(top[i])
+	}
+
+	if len(top) > 0 && top[len(top)-1]&0x80 != 0 {
+		n = -(n &^ (0x80 << (8 * (len(top) - 1))))
+	}
+
+	return n, nil
+}
+
+// verify pops the top of the stack and fails unless it's true
+func (e *scriptEngine) verify() error {
+	top, err := e.pop()
+	if err != nil {
+		return err
+	}
+
+	if !asBool(top) {
+		return errors.New("verify failed")
+	}
+
+	return nil
+}
+
+// asBool interprets a stack element as a boolean: any non-zero byte is true,
+// except for a sign bit alone in the last byte, which is negative zero
+func asBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 && !(i == len(data)-1 && b == 0x80) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fromBool returns the stack element of a boolean
+func fromBool(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+
+	return nil
+}
+
+// scriptNumber encodes a non-negative number as a stack element: little-endian
+// in as few bytes as possible, with the top bit of the last byte as the sign
+func scriptNumber(n int) []byte {
+	var data []byte
+
+	for ; n > 0; n >>= 8 {
+		data = append(data, byte(n))
+	}
+
+	if len(data) > 0 && data[len(data)-1]&0x80 != 0 {
+		data = append(data, 0)
+	}
+
+	return data
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var (
+	keyA = []byte("public key A")
+	keyB = []byte("public key B")
+	keyC = []byte("public key C")
+)
+
+// testSignature returns the signature by pubKey that testChecker accepts
+func testSignature(pubKey []byte) []byte {
+	return append([]byte("signature by "), pubKey...)
+}
+
+// testChecker stands in for the ECDSA checker of an input, so the scripts
+// under test are deterministic
+func testChecker(signature, pubKey []byte) bool {
+	return bytes.Equal(signature, testSignature(pubKey))
+}
+
+// pushes returns a script pushing each element in turn
+func pushes(data ...[]byte) []byte {
+	var script []byte
+	for _, d := range data {
+		script = appendPush(script, d)
+	}
+
+	return script
+}
+
+// repeat returns a script made of n times the opcode op
+func repeat(op byte, n int) []byte {
+	return bytes.Repeat([]byte{op}, n)
+}
+
+// join concatenates script fragments
+func join(fragments ...[]byte) []byte {
+	return bytes.Join(fragments, nil)
+}
+
+func TestVerifyScripts(t *testing.T) {
+	p2pkhA := NewP2PKHScript(HashPubKey(keyA))
+
+	redeem := NewMultisigScript(2, [][]byte{keyA, keyB, keyC})
+	p2sh := NewP2SHScript(HashPubKey(redeem))
+	multisigSig := func(signers ...[]byte) []byte {
+		var signatures [][]byte
+		for _, signer := range signers {
+			signatures = append(signatures, testSignature(signer))
+		}
+
+		return NewMultisigUnlockingScript(signatures, redeem)
+	}
+
+	// OP_1 <A> <B> OP_2 OP_CHECKMULTISIGVERIFY OP_1
+	verifyMultisig := join([]byte{op1}, pushes(keyA, keyB), []byte{op1 + 1, opCheckMultiSigVerify, op1})
+
+	// IF IF 2 ELSE 3 ENDIF ELSE IF 4 ELSE 5 ENDIF ENDIF, the outer condition
+	// pushed last
+	nested := []byte{opIf, opIf, op1 + 1, opElse, op1 + 2, opEndIf, opElse, opIf, op1 + 3, opElse, op1 + 4, opEndIf, opEndIf}
+	nestedIs := func(n int) []byte {
+		return join(nested, []byte{byte(op1 + n - 1), opEqual})
+	}
+
+	element := bytes.Repeat([]byte{1}, maxElementSize)
+
+	tests := []struct {
+		name         string
+		scriptSig    []byte
+		scriptPubKey []byte
+		err          string
+	}{
+		{"p2pkh", NewP2PKHUnlockingScript(testSignature(keyA), keyA), p2pkhA, ""},
+		{"p2pkh signature by another key", NewP2PKHUnlockingScript(testSignature(keyB), keyA), p2pkhA, "locking script: script doesn't end with true"},
+		{"p2pkh another key", NewP2PKHUnlockingScript(testSignature(keyB), keyB), p2pkhA, "locking script: verify failed"},
+		{"p2pkh empty signature", NewP2PKHUnlockingScript(nil, keyA), p2pkhA, "locking script: script doesn't end with true"},
+		{"p2pkh no unlocking script", nil, p2pkhA, "locking script: stack has too few elements"},
+
+		{"p2sh 2-of-3 A B", multisigSig(keyA, keyB), p2sh, ""},
+		{"p2sh 2-of-3 A C", multisigSig(keyA, keyC), p2sh, ""},
+		{"p2sh 2-of-3 B C", multisigSig(keyB, keyC), p2sh, ""},
+		{"p2sh 2-of-3 one signature", multisigSig(keyA), p2sh, "redeem script: stack has too few elements"},
+		{"p2sh 2-of-3 one signature and an empty one", NewMultisigUnlockingScript([][]byte{testSignature(keyA), nil}, redeem), p2sh, "redeem script: script doesn't end with true"},
+		{"p2sh 2-of-3 same key twice", multisigSig(keyA, keyA), p2sh, "redeem script: script doesn't end with true"},
+		{"p2sh 2-of-3 out of order", multisigSig(keyB, keyA), p2sh, "redeem script: script doesn't end with true"},
+		{"p2sh 2-of-3 signature by an unknown key", NewMultisigUnlockingScript([][]byte{testSignature(keyA), testSignature([]byte("other key"))}, redeem), p2sh, "redeem script: script doesn't end with true"},
+		{"p2sh another redeem script", NewMultisigUnlockingScript([][]byte{testSignature(keyA)}, NewMultisigScript(1, [][]byte{keyA})), p2sh, "locking script: script doesn't end with true"},
+		{"bare 2-of-3", pushes(testSignature(keyA), testSignature(keyC)), redeem, ""},
+		{"bare 2-of-3 out of order", pushes(testSignature(keyC), testSignature(keyA)), redeem, "locking script: script doesn't end with true"},
+		{"checkmultisigverify", pushes(testSignature(keyB)), verifyMultisig, ""},
+		{"checkmultisigverify fails", pushes(testSignature(keyC)), verifyMultisig, "locking script: verify failed"},
+		{"multisig more signatures than keys", pushes(testSignature(keyA), testSignature(keyB), testSignature(keyB)), join([]byte{op1 + 2}, pushes(keyA, keyB), []byte{op1 + 1, opCheckMultiSig}), "locking script: 3 signatures required of 2 public keys"},
+		{"multisig too many keys", nil, join(pushes(scriptNumber(maxMultisigKeys+1)), []byte{opCheckMultiSig}), "locking script: 17 public keys, more than 16"},
+
+		{"if", []byte{op1}, []byte{opIf, op1 + 1, opElse, op1 + 2, opEndIf, op1 + 1, opEqual}, ""},
+		{"else", []byte{op0}, []byte{opIf, op1 + 1, opElse, op1 + 2, opEndIf, op1 + 2, opEqual}, ""},
+		{"notif", []byte{op0}, []byte{opNotIf, op1, opElse, op0, opEndIf}, ""},
+		{"nested if if", []byte{op1, op1}, nestedIs(2), ""},
+		{"nested if else", []byte{op0, op1}, nestedIs(3), ""},
+		{"nested else if", []byte{op1, op0}, nestedIs(4), ""},
+		{"nested else else", []byte{op0, op0}, nestedIs(5), ""},
+		{"nested wrong branch", []byte{op1, op1}, nestedIs(3), "locking script: script doesn't end with true"},
+		{"skipped branch isn't executed", []byte{op0}, []byte{opIf, opReturn, 0xff, opEndIf, op1}, ""},
+		{"if without endif", []byte{op1}, []byte{opIf, op1}, "locking script: OP_IF without OP_ENDIF"},
+		{"nested if without endif", []byte{op1, op1}, []byte{opIf, opIf, op1, opEndIf}, "locking script: OP_IF without OP_ENDIF"},
+		{"else without if", nil, []byte{op1, opElse, op1, opEndIf}, "locking script: OP_ELSE without OP_IF"},
+		{"endif without if", nil, []byte{op1, opEndIf}, "locking script: OP_ENDIF without OP_IF"},
+		{"if on an empty stack", nil, []byte{opIf, opEndIf, op1}, "locking script: stack has too few elements"},
+
+		{"stack at the limit", nil, repeat(op1, maxStackSize), ""},
+		{"stack over the limit", nil, repeat(op1, maxStackSize+1), "locking script: stack has more than 1000 elements"},
+		{"operations at the limit", []byte{op1}, repeat(opDup, maxScriptOps), ""},
+		{"operations over the limit", []byte{op1}, repeat(opDup, maxScriptOps+1), "locking script: script has more than 201 operations"},
+		{"skipped operations count", []byte{op0}, join([]byte{opIf}, repeat(opDup, maxScriptOps), []byte{opEndIf, op1}), "locking script: script has more than 201 operations"},
+		{"element at the limit", pushes(element), []byte{opDup, opEqual}, ""},
+		{"element over the limit", pushes(append(element, 1)), []byte{op1}, "unlocking script: pushed element is 521 bytes long, more than 520"},
+		{"script over the limit", nil, repeat(op1, maxScriptSize+1), "locking script: script is 10001 bytes long, more than 10000"},
+
+		{"non-push unlocking script", []byte{op1, opDup}, []byte{opEqual}, "unlocking script: OP_DUP is not a push"},
+		{"conditional in the unlocking script", []byte{op1, opIf, op1, opEndIf}, []byte{op1}, "unlocking script: OP_IF is not a push"},
+		{"non-push p2sh unlocking script", join(pushes(testSignature(keyA), testSignature(keyB)), []byte{opDup}, pushes(redeem)), p2sh, "unlocking script: OP_DUP is not a push"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := verifyScripts(test.scriptSig, test.scriptPubKey, testChecker)
+
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("verifyScripts failed: %s", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("verifyScripts returned %v, want %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import "errors"
+
+// errStopIteration ends a ForEach early when returned by its callback
+var errStopIteration = errors.New("stop iteration")
+
+// tipKey is the key of the best chain tip in the blocks bucket
+var tipKey = []byte("l")
+
+// Store persists blocks, the best chain tip and the buckets of derived state
+// (UTXO set, indexes). All reads and writes go through transactions; an Update
+// transaction is applied atomically or not at all.
+type Store interface {
+	View(fn func(tx StoreTx) error) error
+	Update(fn func(tx StoreTx) error) error
+	Close() error
+}
+
+// StoreTx is a transaction over a Store. Values returned by Get are only valid
+// until the transaction ends and must not be modified.
+type StoreTx interface {
+	GetBlock(hash []byte) *Block
+	PutBlock(block *Block) error
+	Tip() []byte
+	SetTip(hash []byte) error
+
+	HasBucket(bucket string) bool
+	CreateBucket(bucket string) error
+	DeleteBucket(bucket string) error
+	Get(bucket string, key []byte) []byte
+	Put(bucket string, key, value []byte) error
+	Delete(bucket string, key []byte) error
+	ForEach(bucket string, fn func(k, v []byte) error) error
+	KeyCount(bucket string) int
+}
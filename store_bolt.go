@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/boltdb/bolt"
+)
+
+// BoltStore is a Store backed by a bolt database file
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens or creates the bolt database at path
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BoltStore{db}, nil
+}
+
+// View runs fn in a read-only transaction
+func (s *BoltStore) View(fn func(tx StoreTx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+// Update runs fn in a read-write transaction committed when fn returns nil
+func (s *BoltStore) Update(fn func(tx StoreTx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+// Close closes the database file
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t boltTx) GetBlock(hash []byte) *Block {
+	blockData := t.Get(blocksBucket, hash)
+	if blockData == nil {
+		return nil
+	}
+
+	block, err := DeserializeBlock(blockData)
+	if err != nil {
+		log.Panic(fmt.Errorf("block %x: %s", hash, err))
+	}
+
+	return block
+}
+
+func (t boltTx) PutBlock(block *Block) error {
+	return t.Put(blocksBucket, block.Hash, block.Serialize())
+}
+
+func (t boltTx) Tip() []byte {
+	return append([]byte{}, t.Get(blocksBucket, tipKey)...)
+}
+
+func (t boltTx) SetTip(hash []byte) error {
+	return t.Put(blocksBucket, tipKey, hash)
+}
+
+func (t boltTx) HasBucket(bucket string) bool {
+	return t.tx.Bucket([]byte(bucket)) != nil
+}
+
+func (t boltTx) CreateBucket(bucket string) error {
+	_, err := t.tx.CreateBucketIfNotExists([]byte(bucket))
+
+	return err
+}
+
+func (t boltTx) DeleteBucket(bucket string) error {
+	err := t.tx.DeleteBucket([]byte(bucket))
+	if err == bolt.ErrBucketNotFound {
+		return nil
+	}
+
+	return err
+}
+
+func (t boltTx) Get(bucket string, key []byte) []byte {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	return b.Get(key)
+}
+
+func (t boltTx) Put(bucket string, key, value []byte) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return fmt.Errorf("bucket %s is missing", bucket)
+	}
+
+	return b.Put(key, value)
+}
+
+func (t boltTx) Delete(bucket string, key []byte) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return fmt.Errorf("bucket %s is missing", bucket)
+	}
+
+	return b.Delete(key)
+}
+
+func (t boltTx) ForEach(bucket string, fn func(k, v []byte) error) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	return b.ForEach(fn)
+}
+
+func (t boltTx) KeyCount(bucket string) int {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return 0
+	}
+
+	return b.Stats().KeyN
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is a Store kept in memory, so tests and simulations can build
+// chains without touching the disk
+type MemoryStore struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+	closed  bool
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]map[string][]byte)}
+}
+
+// View runs fn in a read-only transaction
+func (s *MemoryStore) View(fn func(tx StoreTx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return errors.New("store is closed")
+	}
+
+	return fn(&memoryTx{store: s})
+}
+
+// Update runs fn in a read-write transaction. Changes are rolled back when fn
+// returns an error or panics.
+func (s *MemoryStore) Update(fn func(tx StoreTx) error) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errors.New("store is closed")
+	}
+
+	tx := &memoryTx{store: s, writable: true}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.rollback()
+			panic(r)
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		tx.rollback()
+	}
+
+	return err
+}
+
+// Close releases the store
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	s.buckets = nil
+
+	return nil
+}
+
+type memoryTx struct {
+	store    *MemoryStore
+	writable bool
+	undo     []func()
+}
+
+func (t *memoryTx) rollback() {
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		t.undo[i]()
+	}
+	t.undo = nil
+}
+
+func (t *memoryTx) GetBlock(hash []byte) *Block {
+	blockData := t.Get(blocksBucket, hash)
+	if blockData == nil {
+		return nil
+	}
+
+	block, err := DeserializeBlock(blockData)
+	if err != nil {
+		log.Panic(fmt.Errorf("block %x: %s", hash, err))
+	}
+
+	return block
+}
+
+func (t *memoryTx) PutBlock(block *Block) error {
+	return t.Put(blocksBucket, block.Hash, block.Serialize())
+}
+
+func (t *memoryTx) Tip() []byte {
+	return append([]byte{}, t.Get(blocksBucket, tipKey)...)
+}
+
+func (t *memoryTx) SetTip(hash []byte) error {
+	return t.Put(blocksBucket, tipKey, hash)
+}
+
+func (t *memoryTx) HasBucket(bucket string) bool {
+	return t.store.buckets[bucket] != nil
+}
+
+func (t *memoryTx) CreateBucket(bucket string) error {
+	if !t.writable {
+		return errors.New("transaction is read-only")
+	}
+
+	if t.store.buckets[bucket] != nil {
+		return nil
+	}
+
+	t.store.buckets[bucket] = make(map[string][]byte)
+	t.undo = append(t.undo, func() { delete(t.store.buckets, bucket) })
+
+	return nil
+}
+
+func (t *memoryTx) DeleteBucket(bucket string) error {
+	if !t.writable {
+		return errors.New("transaction is read-only")
+	}
+
+	b := t.store.buckets[bucket]
+	if b == nil {
+		return nil
+	}
+
+	delete(t.store.buckets, bucket)
+	t.undo = append(t.undo, func() { t.store.buckets[bucket] = b })
+
+	return nil
+}
+
+func (t *memoryTx) Get(bucket string, key []byte) []byte {
+	return t.store.buckets[bucket][string(key)]
+}
+
+func (t *memoryTx) Put(bucket string, key, value []byte) error {
+	b, err := t.writableBucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	k := string(key)
+	prev, existed := b[k]
+	b[k] = append([]byte{}, value...)
+	t.undo = append(t.undo, func() {
+		if existed {
+			b[k] = prev
+		} else {
+			delete(b, k)
+		}
+	})
+
+	return nil
+}
+
+func (t *memoryTx) Delete(bucket string, key []byte) error {
+	b, err := t.writableBucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	k := string(key)
+	prev, existed := b[k]
+	if !existed {
+		return nil
+	}
+
+	delete(b, k)
+	t.undo = append(t.undo, func() { b[k] = prev })
+
+	return nil
+}
+
+// ForEach visits the keys of the bucket in byte order, like bolt does
+func (t *memoryTx) ForEach(bucket string, fn func(k, v []byte) error) error {
+	b := t.store.buckets[bucket]
+
+	var keys []string
+	for k := range b {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		err := fn([]byte(k), b[k])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *memoryTx) KeyCount(bucket string) int {
+	return len(t.store.buckets[bucket])
+}
+
+func (t *memoryTx) writableBucket(bucket string) (map[string][]byte, error) {
+	if !t.writable {
+		return nil, errors.New("transaction is read-only")
+	}
+
+	b := t.store.buckets[bucket]
+	if b == nil {
+		return nil, fmt.Errorf("bucket %s is missing", bucket)
+	}
+
+	return b, nil
+}
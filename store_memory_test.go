@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMemoryStoreRollback(t *testing.T) {
+	db := NewMemoryStore()
+	defer db.Close()
+
+	err := db.Update(func(tx StoreTx) error {
+		for _, bucket := range []string{blocksBucket, "kept", "dropped"} {
+			err := tx.CreateBucket(bucket)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := tx.Put("kept", []byte("a"), []byte("1"))
+		if err != nil {
+			return err
+		}
+
+		err = tx.Put("dropped", []byte("b"), []byte("2"))
+		if err != nil {
+			return err
+		}
+
+		return tx.SetTip([]byte("tip"))
+	})
+	if err != nil {
+		t.Fatalf("setting up the store: %s", err)
+	}
+
+	failure := errors.New("failure")
+	err = db.Update(func(tx StoreTx) error {
+		steps := []error{
+			tx.Put("kept", []byte("a"), []byte("changed")),
+			tx.Put("kept", []byte("c"), []byte("added")),
+			tx.DeleteBucket("dropped"),
+			tx.CreateBucket("created"),
+			tx.Put("created", []byte("d"), []byte("4")),
+			tx.SetTip([]byte("other tip")),
+		}
+		for _, err := range steps {
+			if err != nil {
+				return err
+			}
+		}
+
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("failed update returned %v, want %v", err, failure)
+	}
+
+	err = db.View(func(tx StoreTx) error {
+		if got := tx.Get("kept", []byte("a")); !bytes.Equal(got, []byte("1")) {
+			t.Errorf("changed value is %q after the rollback, want %q", got, "1")
+		}
+		if got := tx.Get("kept", []byte("c")); got != nil {
+			t.Errorf("added value %q is kept after the rollback", got)
+		}
+		if got := tx.Get("dropped", []byte("b")); !bytes.Equal(got, []byte("2")) {
+			t.Errorf("value of the deleted bucket is %q after the rollback, want %q", got, "2")
+		}
+		if tx.HasBucket("created") {
+			t.Error("created bucket is kept after the rollback")
+		}
+		if got := tx.Tip(); !bytes.Equal(got, []byte("tip")) {
+			t.Errorf("tip is %q after the rollback, want %q", got, "tip")
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryStoreRollbackOnPanic(t *testing.T) {
+	db := NewMemoryStore()
+	defer db.Close()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic of the update function isn't passed on")
+			}
+		}()
+
+		db.Update(func(tx StoreTx) error {
+			err := tx.CreateBucket("created")
+			if err != nil {
+				return err
+			}
+
+			panic("failure")
+		})
+	}()
+
+	err := db.View(func(tx StoreTx) error {
+		if tx.HasBucket("created") {
+			t.Error("created bucket is kept after the panic")
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
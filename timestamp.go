@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// medianTimeSpan is the number of blocks whose median timestamp a new block
+// must exceed
+const medianTimeSpan = 11
+
+// defaultMaxFutureDrift is how far ahead of the current time a block timestamp
+// may be, unless configured otherwise
+const defaultMaxFutureDrift = 2 * time.Hour
+
+// medianTimePast returns the median timestamp of the block and up to
+// medianTimeSpan-1 of its ancestors. It returns 0 for no block.
+func medianTimePast(tx StoreTx, block *BlockHeader) int64 {
+	var timestamps []int64
+
+	for block != nil && len(timestamps) < medianTimeSpan {
+		timestamps = append(timestamps, block.Timestamp)
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+		block = getHeader(tx, block.PrevBlockHash)
+	}
+
+	if len(timestamps) == 0 {
+		return 0
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	return timestamps[len(timestamps)/2]
+}
+
+// currentTime returns the time of the clock of the blockchain
+func (bc *Blockchain) currentTime() time.Time {
+	if bc.now == nil {
+		return time.Now()
+	}
+
+	return bc.now()
+}
@@ -8,20 +8,39 @@ import (
 	"crypto/sha256"
 	"math/big"
 
-	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"strings"
+	"time"
 )
 
-const subsidy = 10
+// Transaction versions. Version 0 transactions were created before the binary
+// layout existed; they are stored in it but keep their gob based hashes. They
+// can only spend and create pay-to-pubkey-hash outputs, are signed with r and
+// s concatenated and have no lock time.
+const (
+	legacyTxVersion = 0
+	txVersion       = 1
+)
+
+// Lock times below lockTimeThreshold are block heights, from it they are Unix
+// times
+const lockTimeThreshold = 500000000
+
+// errP2PKHOnly is returned for scripts a legacy transaction can't hold
+var errP2PKHOnly = errors.New("legacy transactions only hold pay-to-pubkey-hash scripts")
 
-// Transaction represents a Bitcoin transaction
+// Transaction represents a Bitcoin transaction. A transaction with a LockTime
+// can't be included in a block until it's final, see IsFinal.
 type Transaction struct {
-	ID   []byte
-	Vin  []TXInput
-	Vout []TXOutput
+	Version  int
+	ID       []byte
+	Vin      []TXInput
+	Vout     []TXOutput
+	LockTime int
 }
 
 // IsCoinbase checks whether the transaction is coinbase
@@ -29,12 +48,121 @@ func (tx Transaction) IsCoinbase() bool {
 	return len(tx.Vin) == 1 && len(tx.Vin[0].Txid) == 0 && tx.Vin[0].Vout == -1
 }
 
-// Serialize returns a serialized Transaction
+// OutputValue returns the sum of the transaction output values
+func (tx Transaction) OutputValue() int {
+	value := 0
+
+	for _, out := range tx.Vout {
+		value += out.Value
+	}
+
+	return value
+}
+
+// IsFinal reports whether the transaction can be included in a block at height
+// whose previous blocks have the median time past medianTime. It's final when
+// its lock time is 0, or a height below height, or a time before medianTime.
+func (tx Transaction) IsFinal(height int, medianTime int64) bool {
+	switch {
+	case tx.LockTime == 0:
+		return true
+	case tx.LockTime < lockTimeThreshold:
+		return tx.LockTime < height
+	default:
+		return int64(tx.LockTime) < medianTime
+	}
+}
+
+// lockTimeString returns a readable form of a lock time: the height or the
+// time it ends at
+func lockTimeString(lockTime int) string {
+	if lockTime < lockTimeThreshold {
+		return fmt.Sprintf("height %d", lockTime)
+	}
+
+	return time.Unix(int64(lockTime), 0).UTC().Format(time.RFC3339)
+}
+
+// CoinbaseData returns the data of the input of a coinbase transaction: its
+// unlocking script, or the public key of a legacy transaction
+func (tx Transaction) CoinbaseData() []byte {
+	if tx.Version == legacyTxVersion {
+		_, data, _ := extractP2PKHUnlocking(tx.Vin[0].ScriptSig)
+		return data
+	}
+
+	return tx.Vin[0].ScriptSig
+}
+
+// Encode writes the transaction in the binary layout described in encoding.go
+func (tx Transaction) Encode(w io.Writer) error {
+	e := &encoder{w: w}
+
+	e.uint32(uint32(tx.Version))
+	e.bytes(tx.ID)
+
+	e.count(len(tx.Vin))
+	for _, vin := range tx.Vin {
+		e.bytes(vin.Txid)
+		e.int64(int64(vin.Vout))
+		e.bytes(vin.ScriptSig)
+	}
+
+	e.count(len(tx.Vout))
+	for _, out := range tx.Vout {
+		e.int64(int64(out.Value))
+		e.bytes(out.ScriptPubKey)
+	}
+
+	e.uint32(uint32(tx.LockTime))
+
+	return e.err
+}
+
+// DecodeTransaction reads a transaction written by Encode
+func DecodeTransaction(r io.Reader) (*Transaction, error) {
+	d := &decoder{r: r}
+	tx := Transaction{}
+
+	version := d.uint32()
+	if d.err == nil && version > txVersion {
+		return nil, fmt.Errorf("unsupported transaction version %d", version)
+	}
+	tx.Version = int(version)
+	tx.ID = d.bytes()
+
+	n := d.count()
+	for i := 0; i < n && d.err == nil; i++ {
+		vin := TXInput{}
+		vin.Txid = d.bytes()
+		vin.Vout = int(d.int64())
+		vin.ScriptSig = d.bytes()
+		tx.Vin = append(tx.Vin, vin)
+	}
+
+	n = d.count()
+	for i := 0; i < n && d.err == nil; i++ {
+		out := TXOutput{}
+		out.Value = int(d.int64())
+		out.ScriptPubKey = d.bytes()
+		tx.Vout = append(tx.Vout, out)
+	}
+
+	tx.LockTime = int(d.uint32())
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return &tx, nil
+}
+
+// Serialize returns a serialized Transaction. Encoding to memory can't fail
+// for a transaction that fits in memory.
 func (tx Transaction) Serialize() []byte {
 	var encoded bytes.Buffer
 
-	enc := gob.NewEncoder(&encoded)
-	err := enc.Encode(tx)
+	err := tx.Encode(&encoded)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -42,6 +170,29 @@ func (tx Transaction) Serialize() []byte {
 	return encoded.Bytes()
 }
 
+// Size returns the length of the serialized transaction, which fees are
+// based on
+func (tx Transaction) Size() int {
+	return len(tx.Serialize())
+}
+
+// DeserializeTransaction deserializes a Transaction
+func DeserializeTransaction(data []byte) (*Transaction, error) {
+	var tx *Transaction
+
+	err := decodeAll(data, func(r io.Reader) error {
+		var err error
+		tx, err = DecodeTransaction(r)
+
+		return err
+	})
+	if err != nil {
+		return nil, errors.New("invalid transaction: " + err.Error())
+	}
+
+	return tx, nil
+}
+
 // Hash returns the hash of the Transaction
 func (tx *Transaction) Hash() []byte {
 	var hash [32]byte
@@ -49,12 +200,64 @@ func (tx *Transaction) Hash() []byte {
 	txCopy := *tx
 	txCopy.ID = []byte{}
 
+	if tx.Version == legacyTxVersion {
+		return legacyTransactionHash(&txCopy)
+	}
+
 	hash = sha256.Sum256(txCopy.Serialize())
 
 	return hash[:]
 }
 
-// Sign signs each input of a Transaction
+// UnsignedHash returns the hash of the Transaction without its unlocking
+// scripts, or without input signatures for a legacy one. Transaction IDs are
+// computed before signing, so this is what an ID commits to. A coinbase isn't
+// signed, its ID commits to its data.
+func (tx *Transaction) UnsignedHash() []byte {
+	if tx.IsCoinbase() {
+		return tx.Hash()
+	}
+
+	txCopy := *tx
+	txCopy.Vin = make([]TXInput, len(tx.Vin))
+
+	for i, vin := range tx.Vin {
+		txCopy.Vin[i] = TXInput{vin.Txid, vin.Vout, nil}
+
+		if tx.Version == legacyTxVersion {
+			_, pubKey, _ := extractP2PKHUnlocking(vin.ScriptSig)
+			txCopy.Vin[i].ScriptSig = NewP2PKHUnlockingScript(nil, pubKey)
+		}
+	}
+
+	return txCopy.Hash()
+}
+
+// signatureHash returns the hash a signature of input inID commits to: the
+// hash of the transaction without unlocking scripts, where the input holds
+// the locking script of the output it spends. The input of a legacy
+// transaction holds the public key hash of that output in place of its public
+// key instead.
+func (tx *Transaction) signatureHash(inID int, scriptPubKey []byte) ([]byte, error) {
+	txCopy := tx.TrimmedCopy()
+
+	if tx.Version == legacyTxVersion {
+		pubKeyHash, ok := extractP2PKH(scriptPubKey)
+		if !ok {
+			return nil, errP2PKHOnly
+		}
+		txCopy.Vin[inID].ScriptSig = NewP2PKHUnlockingScript(nil, pubKeyHash)
+	} else {
+		txCopy.Vin[inID].ScriptSig = scriptPubKey
+	}
+
+	return txCopy.Hash(), nil
+}
+
+// Sign signs each input of a Transaction that spends a pay-to-pubkey-hash
+// output locked to the key, and adds a signature by the key to each input
+// that spends a multisig output the key is part of. Signatures are ASN.1
+// encoded, or r and s concatenated in a legacy transaction.
 func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) {
 	if tx.IsCoinbase() {
 		return
@@ -66,27 +269,104 @@ func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transac
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
+	pubKey := pubKeyBytes(&privKey.PublicKey)
+	pubKeyHash := HashPubKey(pubKey)
+
+	for inID, vin := range tx.Vin {
+		prevOut := prevTXs[hex.EncodeToString(vin.Txid)].Vout[vin.Vout]
+
+		if prevOut.IsLockedWithKey(pubKeyHash) {
+			hash, err := tx.signatureHash(inID, prevOut.ScriptPubKey)
+			if err != nil {
+				log.Panic(err)
+			}
+
+			tx.Vin[inID].ScriptSig = NewP2PKHUnlockingScript(tx.signHash(privKey, hash), pubKey)
+		} else if tx.Version != legacyTxVersion {
+			tx.addMultisigSignature(inID, prevOut, privKey)
+		}
+	}
+}
+
+// addMultisigSignature adds a signature by the key to an input spending a
+// pay-to-script-hash output, if the redeem script its unlocking script holds
+// is a multisig script the key is part of. Signatures stay in the order of
+// their keys, and no more are kept than the script requires.
+func (tx *Transaction) addMultisigSignature(inID int, prevOut TXOutput, privKey ecdsa.PrivateKey) {
+	signatures, redeemScript, ok := extractMultisigUnlocking(tx.Vin[inID].ScriptSig)
+	if !ok {
+		return
+	}
 
-	for inID, vin := range txCopy.Vin {
-		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
-		txCopy.Vin[inID].Signature = nil
-		txCopy.Vin[inID].PubKey = prevTx.Vout[vin.Vout].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Vin[inID].PubKey = nil
+	scriptHash, ok := extractP2SH(prevOut.ScriptPubKey)
+	if !ok || !bytes.Equal(HashPubKey(redeemScript), scriptHash) {
+		return
+	}
+
+	m, pubKeys, _ := extractMultisig(redeemScript)
+	pubKey := pubKeyBytes(&privKey.PublicKey)
+
+	hash, err := tx.signatureHash(inID, prevOut.ScriptPubKey)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	var signed [][]byte
+	for _, key := range pubKeys {
+		if len(signed) == m {
+			break
+		}
+
+		if bytes.Equal(key, pubKey) {
+			signed = append(signed, tx.signHash(privKey, hash))
+			continue
+		}
 
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, txCopy.ID)
+		for _, signature := range signatures {
+			if tx.checkSignature(signature, key, hash) {
+				signed = append(signed, signature)
+				break
+			}
+		}
+	}
+
+	tx.Vin[inID].ScriptSig = NewMultisigUnlockingScript(signed, redeemScript)
+}
+
+// signHash signs a signature hash in the encoding of the transaction version
+func (tx *Transaction) signHash(privKey ecdsa.PrivateKey, hash []byte) []byte {
+	if tx.Version == legacyTxVersion {
+		r, s, err := ecdsa.Sign(rand.Reader, &privKey, hash)
 		if err != nil {
 			log.Panic(err)
 		}
-		signature := append(r.Bytes(), s.Bytes()...)
 
-		tx.Vin[inID].Signature = signature
+		return append(r.Bytes(), s.Bytes()...)
+	}
+
+	signature, err := ecdsa.SignASN1(rand.Reader, &privKey, hash)
+	if err != nil {
+		log.Panic(err)
 	}
+
+	return signature
 }
 
 // String returns a human-readable representation of a transaction
 func (tx Transaction) String() string {
+	return strings.Join(tx.lines(), "\n")
+}
+
+// StringWithFee returns String followed by the fee the transaction pays, for
+// callers that know the outputs it spends
+func (tx Transaction) StringWithFee(fee int) string {
+	lines := append(tx.lines(), fmt.Sprintf("     Fee: %d (%d per %d bytes)", fee, FeeRate(fee, tx.Size()), feeRateUnit))
+
+	return strings.Join(lines, "\n")
+}
+
+// lines returns the lines of String
+func (tx Transaction) lines() []string {
 	var lines []string
 
 	lines = append(lines, fmt.Sprintf("--- Transaction %x:", tx.ID))
@@ -96,17 +376,24 @@ func (tx Transaction) String() string {
 		lines = append(lines, fmt.Sprintf("     Input %d:", i))
 		lines = append(lines, fmt.Sprintf("       TXID:      %x", input.Txid))
 		lines = append(lines, fmt.Sprintf("       Out:       %d", input.Vout))
-		lines = append(lines, fmt.Sprintf("       Signature: %x", input.Signature))
-		lines = append(lines, fmt.Sprintf("       PubKey:    %x", input.PubKey))
+		if tx.IsCoinbase() {
+			lines = append(lines, fmt.Sprintf("       Data:      %q", tx.CoinbaseData()))
+		} else {
+			lines = append(lines, fmt.Sprintf("       Script:    %s", DisassembleScript(input.ScriptSig)))
+		}
 	}
 
 	for i, output := range tx.Vout {
 		lines = append(lines, fmt.Sprintf("     Output %d:", i))
 		lines = append(lines, fmt.Sprintf("       Value:  %d", output.Value))
-		lines = append(lines, fmt.Sprintf("       Script: %x", output.PubKeyHash))
+		lines = append(lines, fmt.Sprintf("       Script: %s", DisassembleScript(output.ScriptPubKey)))
 	}
 
-	return strings.Join(lines, "\n")
+	if tx.LockTime != 0 {
+		lines = append(lines, fmt.Sprintf("     Lock time: %s", lockTimeString(tx.LockTime)))
+	}
+
+	return lines
 }
 
 // TrimmedCopy creates a trimmed copy of Transaction to be used in signing
@@ -115,22 +402,29 @@ func (tx *Transaction) TrimmedCopy() Transaction {
 	var outputs []TXOutput
 
 	for _, vin := range tx.Vin {
-		inputs = append(inputs, TXInput{vin.Txid, vin.Vout, nil, nil})
+		inputs = append(inputs, TXInput{vin.Txid, vin.Vout, nil})
 	}
 
 	for _, vout := range tx.Vout {
-		outputs = append(outputs, TXOutput{vout.Value, vout.PubKeyHash})
+		outputs = append(outputs, TXOutput{vout.Value, vout.ScriptPubKey})
 	}
 
-	txCopy := Transaction{tx.ID, inputs, outputs}
+	txCopy := Transaction{tx.Version, tx.ID, inputs, outputs, tx.LockTime}
 
 	return txCopy
 }
 
-// Verify verifies signatures of Transaction inputs
+// Verify executes the scripts of each input of the Transaction: its unlocking
+// script, then the locking script of the output it spends
 func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
+	return tx.verifyInputs(prevTXs) == nil
+}
+
+// verifyInputs executes the scripts of each input and returns why the first
+// failing one fails
+func (tx *Transaction) verifyInputs(prevTXs map[string]Transaction) error {
 	if tx.IsCoinbase() {
-		return true
+		return nil
 	}
 
 	for _, vin := range tx.Vin {
@@ -139,65 +433,184 @@ func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
+	for inID, vin := range tx.Vin {
+		err := tx.verifyInput(inID, prevTXs[hex.EncodeToString(vin.Txid)].Vout[vin.Vout])
+		if err != nil {
+			return fmt.Errorf("input %d: %s", inID, err)
+		}
+	}
+
+	return nil
+}
+
+// verifyInput executes the unlocking script of an input, then the locking
+// script of the output it spends
+func (tx *Transaction) verifyInput(inID int, prevOut TXOutput) error {
+	hash, err := tx.signatureHash(inID, prevOut.ScriptPubKey)
+	if err != nil {
+		return err
+	}
+
+	return verifyScripts(tx.Vin[inID].ScriptSig, prevOut.ScriptPubKey, func(signature, pubKey []byte) bool {
+		return tx.checkSignature(signature, pubKey, hash)
+	})
+}
+
+// verifyPartialInputs checks a transaction whose multisig inputs may still
+// lack signatures. Those inputs only have the signatures they hold checked,
+// the other ones are verified like verifyInputs does. It returns whether
+// signatures are missing, and why the first failing input fails.
+func (tx *Transaction) verifyPartialInputs(prevTXs map[string]Transaction) (bool, error) {
+	missing := false
 
 	for inID, vin := range tx.Vin {
-		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
-		txCopy.Vin[inID].Signature = nil
-		txCopy.Vin[inID].PubKey = prevTx.Vout[vin.Vout].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Vin[inID].PubKey = nil
-
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(vin.Signature)
-		r.SetBytes(vin.Signature[:(sigLen / 2)])
-		s.SetBytes(vin.Signature[(sigLen / 2):])
-
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(vin.PubKey)
-		x.SetBytes(vin.PubKey[:(keyLen / 2)])
-		y.SetBytes(vin.PubKey[(keyLen / 2):])
-
-		rawPubKey := ecdsa.PublicKey{curve, &x, &y}
-		if ecdsa.Verify(&rawPubKey, txCopy.ID, &r, &s) == false {
+		prevOut := prevTXs[hex.EncodeToString(vin.Txid)].Vout[vin.Vout]
+
+		var err error
+		if signatures, required, ok := vin.MultisigSignatures(); ok && signatures < required {
+			missing = true
+			err = tx.checkPartialMultisig(inID, prevOut)
+		} else {
+			err = tx.verifyInput(inID, prevOut)
+		}
+		if err != nil {
+			return missing, fmt.Errorf("input %d: %s", inID, err)
+		}
+	}
+
+	return missing, nil
+}
+
+// checkPartialMultisig checks an input spending a pay-to-script-hash output
+// that holds fewer signatures than its multisig redeem script requires: the
+// redeem script must be the one the output locks to, and each signature must
+// be valid for one of its keys, in the order of the keys
+func (tx *Transaction) checkPartialMultisig(inID int, prevOut TXOutput) error {
+	signatures, redeemScript, _ := extractMultisigUnlocking(tx.Vin[inID].ScriptSig)
+
+	scriptHash, ok := extractP2SH(prevOut.ScriptPubKey)
+	if !ok || !bytes.Equal(HashPubKey(redeemScript), scriptHash) {
+		return errors.New("redeem script doesn't match the spent output")
+	}
+	_, pubKeys, _ := extractMultisig(redeemScript)
+
+	hash, err := tx.signatureHash(inID, prevOut.ScriptPubKey)
+	if err != nil {
+		return err
+	}
+
+	k := 0
+	for i, signature := range signatures {
+		for k < len(pubKeys) && !tx.checkSignature(signature, pubKeys[k], hash) {
+			k++
+		}
+		if k == len(pubKeys) {
+			return fmt.Errorf("signature %d doesn't match a key of the redeem script", i)
+		}
+		k++
+	}
+
+	return nil
+}
+
+// checkSignature verifies a signature of hash by a public key in the encoding
+// of the transaction version. Keys have fixed-width coordinates, except in
+// legacy transactions where they are split in half as they come.
+func (tx *Transaction) checkSignature(signature, pubKey, hash []byte) bool {
+	if tx.Version != legacyTxVersion {
+		key, err := parsePubKey(pubKey)
+		if err != nil {
 			return false
 		}
+
+		return ecdsa.VerifyASN1(key, hash, signature)
 	}
 
-	return true
+	x := big.Int{}
+	y := big.Int{}
+	keyLen := len(pubKey)
+	x.SetBytes(pubKey[:(keyLen / 2)])
+	y.SetBytes(pubKey[(keyLen / 2):])
+
+	rawPubKey := ecdsa.PublicKey{Curve: elliptic.P256(), X: &x, Y: &y}
+
+	r := big.Int{}
+	s := big.Int{}
+	sigLen := len(signature)
+	r.SetBytes(signature[:(sigLen / 2)])
+	s.SetBytes(signature[(sigLen / 2):])
+
+	return ecdsa.Verify(&rawPubKey, hash, &r, &s)
 }
 
-// NewCoinbaseTX creates a new coinbase transaction
-func NewCoinbaseTX(to, data string) *Transaction {
+// prevTXsFromOutputs builds the previous transactions Sign and Verify expect
+// from the outputs spent by the inputs of tx, given in the order of its inputs.
+// Only the spent outputs of the returned transactions are filled in.
+func prevTXsFromOutputs(tx *Transaction, spent []TXOutput) map[string]Transaction {
+	prevTXs := make(map[string]Transaction)
+
+	for i, vin := range tx.Vin {
+		txID := hex.EncodeToString(vin.Txid)
+		prevTX := prevTXs[txID]
+		prevTX.ID = vin.Txid
+
+		for len(prevTX.Vout) <= vin.Vout {
+			prevTX.Vout = append(prevTX.Vout, TXOutput{})
+		}
+		prevTX.Vout[vin.Vout] = spent[i]
+
+		prevTXs[txID] = prevTX
+	}
+
+	return prevTXs
+}
+
+// NewCoinbaseTX creates a new coinbase transaction paying value to to
+func NewCoinbaseTX(to, data string, value int) *Transaction {
 	if data == "" {
 		data = fmt.Sprintf("Reward to '%s'", to)
 	}
 
-	txin := TXInput{[]byte{}, -1, nil, []byte(data)}
-	txout := NewTXOutput(subsidy, to)
-	tx := Transaction{nil, []TXInput{txin}, []TXOutput{*txout}}
+	txin := TXInput{[]byte{}, -1, []byte(data)}
+	txout := NewTXOutput(value, to)
+	tx := Transaction{txVersion, nil, []TXInput{txin}, []TXOutput{*txout}, 0}
 	tx.ID = tx.Hash()
 
 	return &tx
 }
 
-// NewUTXOTransaction creates a new transaction
-func NewUTXOTransaction(from, to string, amount int, bc *Blockchain) *Transaction {
+// maxSignatureSize is the most an ASN.1 encoded signature adds to an
+// unlocking script, with the opcode pushing it
+const maxSignatureSize = 73
+
+// NewUTXOTransaction creates a new transaction paying amount to to and fee to
+// the miner of its block, final from lockTime on
+func NewUTXOTransaction(wallet *Wallet, to string, amount, fee, lockTime int, UTXOSet *UTXOSet) *Transaction {
+	tx := newPaymentTransaction(string(wallet.GetAddress()), nil, to, amount, fee, lockTime, UTXOSet)
+	UTXOSet.Blockchain.SignTransaction(tx, wallet.PrivateKey)
+
+	return tx
+}
+
+// NewMultisigTransaction creates a new transaction paying amount to to and fee
+// from the address of a multisig redeem script. It isn't signed: its inputs
+// hold the redeem script for the signers to add their signatures.
+func NewMultisigTransaction(redeemScript []byte, to string, amount, fee, lockTime int, UTXOSet *UTXOSet) *Transaction {
+	from := string(encodeScriptAddress(HashPubKey(redeemScript)))
+
+	return newPaymentTransaction(from, NewMultisigUnlockingScript(nil, redeemScript), to, amount, fee, lockTime, UTXOSet)
+}
+
+// newPaymentTransaction builds a transaction paying amount to to and fee from
+// the outputs of from, with the change back to from. Its inputs hold scriptSig
+// until they are signed.
+func newPaymentTransaction(from string, scriptSig []byte, to string, amount, fee, lockTime int, UTXOSet *UTXOSet) *Transaction {
 	var inputs []TXInput
 	var outputs []TXOutput
 
-	wallets, err := NewWallets()
-	if err != nil {
-		log.Panic(err)
-	}
-	wallet := wallets.GetWallet(from)
-	pubKeyHash := HashPubKey(wallet.PublicKey)
-	acc, validOutputs := bc.FindSpendableOutputs(pubKeyHash, amount)
+	acc, validOutputs := UTXOSet.FindSpendableOutputs(AddressScript(from), amount+fee)
 
-	if acc < amount {
+	if acc < amount+fee {
 		log.Panic("ERROR: Not enough funds")
 	}
 
@@ -209,20 +622,54 @@ func NewUTXOTransaction(from, to string, amount int, bc *Blockchain) *Transactio
 		}
 
 		for _, out := range outs {
-			input := TXInput{txID, out, nil, wallet.PublicKey}
+			input := TXInput{txID, out, scriptSig}
 			inputs = append(inputs, input)
 		}
 	}
 
 	// Build a list of outputs
 	outputs = append(outputs, *NewTXOutput(amount, to))
-	if acc > amount {
-		outputs = append(outputs, *NewTXOutput(acc-amount, from)) // a change
+	if acc > amount+fee {
+		outputs = append(outputs, *NewTXOutput(acc-amount-fee, from)) // a change
 	}
 
-	tx := Transaction{nil, inputs, outputs}
-	tx.ID = tx.Hash()
-	bc.SignTransaction(&tx, wallet.PrivateKey)
+	tx := Transaction{txVersion, nil, inputs, outputs, lockTime}
+	tx.ID = tx.UnsignedHash()
 
 	return &tx
 }
+
+// NewUTXOTransactionAtFeeRate creates a new transaction paying amount to to
+// and a fee at rate for its size. Paying the fee can take more inputs, so the
+// transaction is rebuilt until its fee covers its size.
+func NewUTXOTransactionAtFeeRate(wallet *Wallet, to string, amount, rate, lockTime int, UTXOSet *UTXOSet) *Transaction {
+	fee := 0
+
+	for {
+		tx := NewUTXOTransaction(wallet, to, amount, fee, lockTime, UTXOSet)
+
+		required := FeeForSize(rate, tx.Size())
+		if fee >= required {
+			return tx
+		}
+		fee = required
+	}
+}
+
+// NewMultisigTransactionAtFeeRate creates a new transaction from the address
+// of a multisig redeem script like NewMultisigTransaction, paying a fee at
+// rate for the size it will have once the required signatures are added
+func NewMultisigTransactionAtFeeRate(redeemScript []byte, to string, amount, rate, lockTime int, UTXOSet *UTXOSet) *Transaction {
+	m, _, _ := extractMultisig(redeemScript)
+	fee := 0
+
+	for {
+		tx := NewMultisigTransaction(redeemScript, to, amount, fee, lockTime, UTXOSet)
+
+		required := FeeForSize(rate, tx.Size()+len(tx.Vin)*m*maxSignatureSize)
+		if fee >= required {
+			return tx
+		}
+		fee = required
+	}
+}
@@ -2,17 +2,33 @@ package main
 
 import "bytes"
 
-// TXInput represents a transaction input
+// TXInput represents a transaction input. ScriptSig unlocks the output it
+// spends; in legacy transactions it is a pay-to-pubkey-hash unlocking script.
 type TXInput struct {
 	Txid      []byte
 	Vout      int
-	Signature []byte
-	PubKey    []byte
+	ScriptSig []byte
 }
 
 // UsesKey checks whether the address initiated the transaction
 func (in *TXInput) UsesKey(pubKeyHash []byte) bool {
-	lockingHash := HashPubKey(in.PubKey)
+	_, pubKey, ok := extractP2PKHUnlocking(in.ScriptSig)
+	if !ok {
+		return false
+	}
+	lockingHash := HashPubKey(pubKey)
 
 	return bytes.Compare(lockingHash, pubKeyHash) == 0
 }
+
+// MultisigSignatures returns the number of signatures the input holds and the
+// number it requires, when it spends a multisig pay-to-script-hash output
+func (in *TXInput) MultisigSignatures() (int, int, bool) {
+	signatures, redeemScript, ok := extractMultisigUnlocking(in.ScriptSig)
+	if !ok {
+		return 0, 0, false
+	}
+	m, _, _ := extractMultisig(redeemScript)
+
+	return len(signatures), m, true
+}
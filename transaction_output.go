@@ -1,23 +1,30 @@
 package main
 
-import "bytes"
+import (
+	"bytes"
+	"encoding/gob"
+	"log"
+	"sort"
+)
 
-// TXOutput represents a transaction output
+// TXOutput represents a transaction output. ScriptPubKey is the script that
+// locks it; in legacy transactions it is a pay-to-pubkey-hash script.
 type TXOutput struct {
-	Value      int
-	PubKeyHash []byte
+	Value        int
+	ScriptPubKey []byte
 }
 
-// Lock signs the output
+// Lock locks the output to an address with the script paying to it
 func (out *TXOutput) Lock(address []byte) {
-	pubKeyHash := Base58Decode(address)
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	out.PubKeyHash = pubKeyHash
+	out.ScriptPubKey = AddressScript(string(address))
 }
 
-// IsLockedWithKey checks if the output can be used by the owner of the pubkey
+// IsLockedWithKey checks if the output is a pay-to-pubkey-hash output to the
+// owner of the pubkey
 func (out *TXOutput) IsLockedWithKey(pubKeyHash []byte) bool {
-	return bytes.Compare(out.PubKeyHash, pubKeyHash) == 0
+	lockingHash, ok := extractP2PKH(out.ScriptPubKey)
+
+	return ok && bytes.Compare(lockingHash, pubKeyHash) == 0
 }
 
 // NewTXOutput create a new TXOutput
@@ -27,3 +34,67 @@ func NewTXOutput(value int, address string) *TXOutput {
 
 	return txo
 }
+
+// TXOutputs collects the unspent outputs of a transaction keyed by their
+// index. Whether the transaction is a coinbase and the height of its block
+// decide when the outputs mature.
+type TXOutputs struct {
+	Outputs  map[int]TXOutput
+	Coinbase bool
+	Height   int
+}
+
+// NewTXOutputs returns all the outputs of a transaction in a block at height
+func NewTXOutputs(tx *Transaction, height int) TXOutputs {
+	outs := TXOutputs{make(map[int]TXOutput), tx.IsCoinbase(), height}
+
+	for outIdx, out := range tx.Vout {
+		outs.Outputs[outIdx] = out
+	}
+
+	return outs
+}
+
+// IsMature reports whether the outputs can be spent in a block at height.
+// Outputs of the genesis block can't be orphaned and are always mature.
+func (outs TXOutputs) IsMature(height int) bool {
+	return !outs.Coinbase || outs.Height == 0 || height-outs.Height >= activeParams.CoinbaseMaturity
+}
+
+// Indexes returns the output indexes in ascending order
+func (outs TXOutputs) Indexes() []int {
+	var indexes []int
+
+	for outIdx := range outs.Outputs {
+		indexes = append(indexes, outIdx)
+	}
+	sort.Ints(indexes)
+
+	return indexes
+}
+
+// Serialize serializes TXOutputs
+func (outs TXOutputs) Serialize() []byte {
+	var buff bytes.Buffer
+
+	enc := gob.NewEncoder(&buff)
+	err := enc.Encode(outs)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return buff.Bytes()
+}
+
+// DeserializeOutputs deserializes TXOutputs
+func DeserializeOutputs(data []byte) TXOutputs {
+	var outputs TXOutputs
+
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	err := dec.Decode(&outputs)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return outputs
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"testing"
+)
+
+// walletWithKey returns a new wallet whose public key satisfies match
+func walletWithKey(match func(pubKey *ecdsa.PublicKey) bool) *Wallet {
+	for {
+		wallet := NewWallet()
+		if match(&wallet.PrivateKey.PublicKey) {
+			return wallet
+		}
+	}
+}
+
+func TestShortCoordinateKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		match func(pubKey *ecdsa.PublicKey) bool
+	}{
+		{"short X", func(pubKey *ecdsa.PublicKey) bool { return pubKey.X.BitLen() <= 248 }},
+		{"short Y", func(pubKey *ecdsa.PublicKey) bool { return pubKey.Y.BitLen() <= 248 }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			alice, bob := walletWithKey(test.match), NewWallet()
+			if len(alice.PublicKey) != pubKeyLen {
+				t.Fatalf("public key is %d bytes long, want %d", len(alice.PublicKey), pubKeyLen)
+			}
+
+			bc := newTestBlockchain(t, string(alice.GetAddress()))
+			payment := NewUTXOTransaction(alice, string(bob.GetAddress()), 4, 1, 0, &UTXOSet{bc})
+			mineBlock(t, bc, string(bob.GetAddress()), payment)
+			if got := balanceOf(bc, bob); got != 4+10+1 {
+				t.Errorf("bob has %d, want the payment, the subsidy and the fee", got)
+			}
+		})
+	}
+}
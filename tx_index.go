@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+)
+
+const txIndexBucket = "txindex"
+
+// TxLocation points to a transaction inside a stored block
+type TxLocation struct {
+	BlockHash []byte
+	Position  int
+}
+
+// Serialize serializes TxLocation
+func (loc TxLocation) Serialize() []byte {
+	var buff bytes.Buffer
+
+	enc := gob.NewEncoder(&buff)
+	err := enc.Encode(loc)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return buff.Bytes()
+}
+
+// DeserializeTxLocation deserializes TxLocation
+func DeserializeTxLocation(data []byte) TxLocation {
+	var loc TxLocation
+
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	err := dec.Decode(&loc)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return loc
+}
+
+// indexTransactions records the location of every transaction of the block.
+// The index is optional: stores without the bucket are left untouched and
+// lookups fall back to scanning the chain. It is built on demand by
+// reindexTransactions.
+func indexTransactions(tx StoreTx, block *Block) error {
+	if !tx.HasBucket(txIndexBucket) {
+		return nil
+	}
+
+	for i, btx := range block.Transactions {
+		loc := TxLocation{block.Hash, i}
+
+		err := tx.Put(txIndexBucket, btx.ID, loc.Serialize())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unindexTransactions removes the transactions of a disconnected block from the index
+func unindexTransactions(tx StoreTx, block *Block) error {
+	if !tx.HasBucket(txIndexBucket) {
+		return nil
+	}
+
+	for _, btx := range block.Transactions {
+		err := tx.Delete(txIndexBucket, btx.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reindexTransactions builds the transaction index from scratch out of the
+// best chain and returns the number of indexed transactions. Pruned blocks
+// are skipped as their transactions are gone.
+func reindexTransactions(tx StoreTx) (int, error) {
+	if tx.HasBucket(txIndexBucket) {
+		err := tx.DeleteBucket(txIndexBucket)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err := tx.CreateBucket(txIndexBucket)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	bestHeight := getHeader(tx, tx.Tip()).Height
+	for height := prunedHeight(tx); height <= bestHeight; height++ {
+		hash := tx.Get(heightsBucket, IntToHex(int64(height)))
+		block := tx.GetBlock(hash)
+		if block == nil {
+			return 0, fmt.Errorf("block %d %x is missing", height, hash)
+		}
+
+		err = indexTransactions(tx, block)
+		if err != nil {
+			return 0, err
+		}
+		count += len(block.Transactions)
+	}
+
+	return count, nil
+}
+
+// HasTxIndex reports whether the transaction index is kept
+func (bc *Blockchain) HasTxIndex() bool {
+	found := false
+
+	err := bc.db.View(func(tx StoreTx) error {
+		found = tx.HasBucket(txIndexBucket)
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return found
+}
+
+// ReindexTransactions builds the transaction index out of the best chain, or
+// rebuilds it if present, and returns the number of indexed transactions
+func (bc *Blockchain) ReindexTransactions() int {
+	count := 0
+
+	err := bc.db.Update(func(tx StoreTx) error {
+		var err error
+		count, err = reindexTransactions(tx)
+
+		return err
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return count
+}
+
+// DropTxIndex deletes the transaction index, lookups scan the chain again
+func (bc *Blockchain) DropTxIndex() {
+	err := bc.db.Update(func(tx StoreTx) error {
+		if !tx.HasBucket(txIndexBucket) {
+			return nil
+		}
+
+		return tx.DeleteBucket(txIndexBucket)
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// locateTransaction looks a best chain transaction up within a store transaction
+func locateTransaction(tx StoreTx, ID []byte) (TxLocation, error) {
+	if tx.HasBucket(txIndexBucket) {
+		data := tx.Get(txIndexBucket, ID)
+		if data == nil {
+			return TxLocation{}, errors.New("Transaction is not found")
+		}
+
+		return DeserializeTxLocation(data), nil
+	}
+
+	hash := tx.Tip()
+
+	for len(hash) > 0 {
+		block, err := getFullBlock(tx, hash)
+		if err != nil {
+			return TxLocation{}, err
+		}
+
+		for i, btx := range block.Transactions {
+			if bytes.Compare(btx.ID, ID) == 0 {
+				return TxLocation{block.Hash, i}, nil
+			}
+		}
+
+		hash = block.PrevBlockHash
+	}
+
+	return TxLocation{}, errors.New("Transaction is not found")
+}
+
+// findTransaction finds a best chain transaction within a store transaction
+func findTransaction(tx StoreTx, ID []byte) (Transaction, error) {
+	loc, err := locateTransaction(tx, ID)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	block, err := getFullBlock(tx, loc.BlockHash)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	return *block.Transactions[loc.Position], nil
+}
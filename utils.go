@@ -23,3 +23,8 @@ func ReverseBytes(data []byte) {
 		data[i], data[j] = data[j], data[i]
 	}
 }
+
+// HexToInt converts a byte array written by IntToHex back to an int64
+func HexToInt(data []byte) int64 {
+	return int64(binary.BigEndian.Uint64(data))
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+)
+
+const utxoBucket = "chainstate"
+const undoBucket = "undo"
+
+// UTXOSet represents the set of unspent transaction outputs stored in the chainstate bucket
+type UTXOSet struct {
+	Blockchain *Blockchain
+}
+
+// SpentOutput is an output consumed by a block, kept to restore it when the block is disconnected
+type SpentOutput struct {
+	Txid     []byte
+	Vout     int
+	Output   TXOutput
+	Coinbase bool
+	Height   int
+}
+
+// BlockUndo holds the outputs spent by a block
+type BlockUndo struct {
+	Spent []SpentOutput
+}
+
+// Serialize serializes BlockUndo
+func (undo BlockUndo) Serialize() []byte {
+	var buff bytes.Buffer
+
+	enc := gob.NewEncoder(&buff)
+	err := enc.Encode(undo)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return buff.Bytes()
+}
+
+// DeserializeBlockUndo deserializes BlockUndo
+func DeserializeBlockUndo(data []byte) BlockUndo {
+	var undo BlockUndo
+
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	err := dec.Decode(&undo)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return undo
+}
+
+// FindSpendableOutputs finds and returns unspent outputs locked with the
+// script to reference in inputs. Coinbase outputs that won't be mature in the next block and outputs
+// already spent by pending transactions are skipped.
+func (u UTXOSet) FindSpendableOutputs(scriptPubKey []byte, amount int) (int, map[string][]int) {
+	unspentOutputs := make(map[string][]int)
+	accumulated := 0
+	db := u.Blockchain.db
+
+	err := db.View(func(tx StoreTx) error {
+		nextHeight := getHeader(tx, tx.Tip()).Height + 1
+
+		pending, err := pendingSpends(tx)
+		if err != nil {
+			return err
+		}
+
+		return tx.ForEach(utxoBucket, func(k, v []byte) error {
+			txID := hex.EncodeToString(k)
+			outs := DeserializeOutputs(v)
+			if !outs.IsMature(nextHeight) {
+				return nil
+			}
+
+			for _, outIdx := range outs.Indexes() {
+				out := outs.Outputs[outIdx]
+
+				if bytes.Equal(out.ScriptPubKey, scriptPubKey) && !pending[outpointKey(k, outIdx)] {
+					accumulated += out.Value
+					unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
+
+					if accumulated >= amount {
+						return errStopIteration
+					}
+				}
+			}
+
+			return nil
+		})
+	})
+	if err != nil && err != errStopIteration {
+		log.Panic(err)
+	}
+
+	return accumulated, unspentOutputs
+}
+
+// FindSpentOutputs returns the unspent outputs referenced by the inputs of a
+// transaction, in the order of its inputs
+func (u UTXOSet) FindSpentOutputs(transaction *Transaction) ([]TXOutput, error) {
+	var spent []TXOutput
+	db := u.Blockchain.db
+
+	err := db.View(func(tx StoreTx) error {
+		for _, vin := range transaction.Vin {
+			var outs TXOutputs
+			if data := tx.Get(utxoBucket, vin.Txid); data != nil {
+				outs = DeserializeOutputs(data)
+			}
+
+			out, ok := outs.Outputs[vin.Vout]
+			if !ok {
+				return fmt.Errorf("output %x:%d is not found or already spent", vin.Txid, vin.Vout)
+			}
+			spent = append(spent, out)
+		}
+
+		return nil
+	})
+
+	return spent, err
+}
+
+// Balance returns the value of the unspent outputs locked with the script,
+// split between the outputs spendable in the next block and the coinbase
+// outputs that are not mature yet
+func (u UTXOSet) Balance(scriptPubKey []byte) (mature, immature int) {
+	db := u.Blockchain.db
+
+	err := db.View(func(tx StoreTx) error {
+		nextHeight := getHeader(tx, tx.Tip()).Height + 1
+
+		return tx.ForEach(utxoBucket, func(k, v []byte) error {
+			outs := DeserializeOutputs(v)
+
+			for _, out := range outs.Outputs {
+				if !bytes.Equal(out.ScriptPubKey, scriptPubKey) {
+					continue
+				}
+
+				if outs.IsMature(nextHeight) {
+					mature += out.Value
+				} else {
+					immature += out.Value
+				}
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return mature, immature
+}
+
+// FindUTXO finds and returns all unspent outputs locked with the script
+func (u UTXOSet) FindUTXO(scriptPubKey []byte) []TXOutput {
+	var UTXOs []TXOutput
+	db := u.Blockchain.db
+
+	err := db.View(func(tx StoreTx) error {
+		return tx.ForEach(utxoBucket, func(k, v []byte) error {
+			outs := DeserializeOutputs(v)
+
+			for _, outIdx := range outs.Indexes() {
+				out := outs.Outputs[outIdx]
+
+				if bytes.Equal(out.ScriptPubKey, scriptPubKey) {
+					UTXOs = append(UTXOs, out)
+				}
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return UTXOs
+}
+
+// CountTransactions returns the number of transactions in the UTXO set
+func (u UTXOSet) CountTransactions() int {
+	db := u.Blockchain.db
+	counter := 0
+
+	err := db.View(func(tx StoreTx) error {
+		counter = tx.KeyCount(utxoBucket)
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return counter
+}
+
+// CirculatingSupply returns the coins in circulation once the best chain block
+// at height is connected. The blocks above it are taken back from the UTXO
+// set: the outputs they created are subtracted and the outputs their undo data
+// says they spent are added back. It fails when those blocks are pruned.
+func (u UTXOSet) CirculatingSupply(height int) (int, error) {
+	db := u.Blockchain.db
+	supply := 0
+
+	err := db.View(func(tx StoreTx) error {
+		bestHeight := getHeader(tx, tx.Tip()).Height
+		if height < 0 || height > bestHeight {
+			return errors.New("Block height is out of range")
+		}
+		if pruned := prunedHeight(tx); height+1 < pruned {
+			return fmt.Errorf("blocks below height %d are pruned, the supply at height %d can't be computed", pruned, height)
+		}
+
+		var err error
+		supply, err = utxoValue(tx)
+		if err != nil {
+			return err
+		}
+
+		for h := bestHeight; h > height; h-- {
+			hash := tx.Get(heightsBucket, IntToHex(int64(h)))
+			block := tx.GetBlock(hash)
+			undoData := tx.Get(undoBucket, hash)
+			if block == nil || undoData == nil {
+				return fmt.Errorf("block %x at height %d is missing", hash, h)
+			}
+
+			for _, btx := range block.Transactions {
+				supply -= btx.OutputValue()
+			}
+			for _, spent := range DeserializeBlockUndo(undoData).Spent {
+				supply += spent.Output.Value
+			}
+		}
+
+		return nil
+	})
+
+	return supply, err
+}
+
+// utxoValue returns the value of all unspent outputs
+func utxoValue(tx StoreTx) (int, error) {
+	total := 0
+
+	err := tx.ForEach(utxoBucket, func(k, v []byte) error {
+		for _, out := range DeserializeOutputs(v).Outputs {
+			total += out.Value
+		}
+
+		return nil
+	})
+
+	return total, err
+}
+
+// Reindex rebuilds the UTXO set from the blocks bucket
+func (u UTXOSet) Reindex() {
+	db := u.Blockchain.db
+	UTXO := u.Blockchain.ScanUTXO()
+
+	err := db.Update(func(tx StoreTx) error {
+		err := tx.DeleteBucket(utxoBucket)
+		if err != nil {
+			return err
+		}
+
+		err = tx.CreateBucket(utxoBucket)
+		if err != nil {
+			return err
+		}
+
+		for txID, outs := range UTXO {
+			key, err := hex.DecodeString(txID)
+			if err != nil {
+				return err
+			}
+
+			err = tx.Put(utxoBucket, key, outs.Serialize())
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// connect applies the transactions of a newly connected block to the UTXO set
+// and records the outputs it spends in the undo bucket. It runs inside the
+// store transaction that stores the block, so both writes are committed or
+// rolled back together.
+func (u UTXOSet) connect(tx StoreTx, block *Block) error {
+	undo := BlockUndo{}
+	fees := 0
+
+	for _, btx := range block.Transactions {
+		if btx.IsCoinbase() == false {
+			inValue := 0
+			var spent []TXOutput
+
+			for _, vin := range btx.Vin {
+				data := tx.Get(utxoBucket, vin.Txid)
+				if data == nil {
+					return fmt.Errorf("output %x:%d is already spent", vin.Txid, vin.Vout)
+				}
+
+				outs := DeserializeOutputs(data)
+				out, ok := outs.Outputs[vin.Vout]
+				if !ok {
+					return fmt.Errorf("output %x:%d is already spent", vin.Txid, vin.Vout)
+				}
+				if !outs.IsMature(block.Height) {
+					return fmt.Errorf("transaction %x spends the coinbase output %x:%d of height %d before it matures", btx.ID, vin.Txid, vin.Vout, outs.Height)
+				}
+				delete(outs.Outputs, vin.Vout)
+				undo.Spent = append(undo.Spent, SpentOutput{vin.Txid, vin.Vout, out, outs.Coinbase, outs.Height})
+				spent = append(spent, out)
+				inValue += out.Value
+
+				var err error
+				if len(outs.Outputs) == 0 {
+					err = tx.Delete(utxoBucket, vin.Txid)
+				} else {
+					err = tx.Put(utxoBucket, vin.Txid, outs.Serialize())
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			outValue := btx.OutputValue()
+			if outValue > inValue {
+				return fmt.Errorf("transaction %x creates %d from inputs worth %d", btx.ID, outValue, inValue)
+			}
+			fees += inValue - outValue
+
+			err := checkTransactionSignatures(btx, spent)
+			if err != nil {
+				return err
+			}
+		}
+
+		// A transaction may not replace the unspent outputs of an earlier
+		// one with the same ID, disconnecting it would delete them for good
+		if tx.Get(utxoBucket, btx.ID) != nil {
+			return fmt.Errorf("transaction %x overwrites the unspent outputs of an earlier transaction", btx.ID)
+		}
+
+		err := tx.Put(utxoBucket, btx.ID, NewTXOutputs(btx, block.Height).Serialize())
+		if err != nil {
+			return err
+		}
+	}
+
+	err := checkCoinbaseValue(block, fees)
+	if err != nil {
+		return err
+	}
+
+	return tx.Put(undoBucket, block.Hash, undo.Serialize())
+}
+
+// disconnect reverts the changes connect made for the block: its outputs are
+// removed and the outputs it spent are restored from the undo bucket
+func (u UTXOSet) disconnect(tx StoreTx, block *Block) error {
+	undoData := tx.Get(undoBucket, block.Hash)
+	if undoData == nil {
+		return fmt.Errorf("undo data of block %x is missing", block.Hash)
+	}
+	undo := DeserializeBlockUndo(undoData)
+
+	created := make(map[string]bool)
+	for _, btx := range block.Transactions {
+		created[hex.EncodeToString(btx.ID)] = true
+
+		err := tx.Delete(utxoBucket, btx.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, spent := range undo.Spent {
+		// Outputs created and spent within the block are gone for good
+		if created[hex.EncodeToString(spent.Txid)] {
+			continue
+		}
+
+		outs := TXOutputs{make(map[int]TXOutput), spent.Coinbase, spent.Height}
+		if data := tx.Get(utxoBucket, spent.Txid); data != nil {
+			outs = DeserializeOutputs(data)
+		}
+		outs.Outputs[spent.Vout] = spent.Output
+
+		err := tx.Put(utxoBucket, spent.Txid, outs.Serialize())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Delete(undoBucket, block.Hash)
+}
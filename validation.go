@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// checkHeader checks a block header on top of parent, nil for the genesis
+// block, against the consensus rules of the chain
+func (bc *Blockchain) checkHeader(tx StoreTx, header, parent *BlockHeader) error {
+	legacy := header.Height < legacyHeight(tx)
+
+	err := checkBlockHeader(header, parent, legacy)
+	if err != nil {
+		return err
+	}
+
+	err = bc.engine.VerifyHeader(tx, header, parent)
+	if err != nil {
+		return err
+	}
+
+	return checkBlockTime(header, medianTimePast(tx, parent), legacy, bc.currentTime(), bc.maxFutureDrift)
+}
+
+// checkBlockHeader checks that the block links to its parent and has the
+// legacy header version if it's one of the legacy blocks a migrated chain
+// starts with, the current version otherwise. The parent of the genesis block
+// is nil. The seal of the block is checked by the consensus engine.
+func checkBlockHeader(block, parent *BlockHeader, legacy bool) error {
+	if parent == nil {
+		if len(block.PrevBlockHash) != 0 || block.Height != 0 {
+			return errors.New("genesis block must have no previous block and height 0")
+		}
+	} else {
+		if bytes.Compare(block.PrevBlockHash, parent.Hash) != 0 {
+			return fmt.Errorf("previous block hash %x doesn't match %x", block.PrevBlockHash, parent.Hash)
+		}
+
+		if block.Height != parent.Height+1 {
+			return fmt.Errorf("block height %d doesn't follow %d", block.Height, parent.Height)
+		}
+	}
+
+	version := headerVersion
+	if legacy {
+		version = legacyHeaderVersion
+	}
+
+	switch {
+	case block.Version != version:
+		return fmt.Errorf("block header version %d isn't the version %d of height %d", block.Version, version, block.Height)
+	case legacy:
+		// hashed as a concatenation, hashes of any length are part of it
+	case len(block.PrevBlockHash) != 0 && len(block.PrevBlockHash) != 32, len(block.TxRoot) != 32:
+		return errors.New("block header hashes must be 32 bytes long")
+	}
+
+	return nil
+}
+
+// checkBlockTime checks that the timestamp of a block exceeds the median time
+// past of its parent, unless it's a legacy block mined before that rule, and
+// isn't more than maxDrift ahead of now
+func checkBlockTime(block *BlockHeader, medianTime int64, legacy bool, now time.Time, maxDrift time.Duration) error {
+	if !legacy && block.Timestamp <= medianTime {
+		return fmt.Errorf("block timestamp %d isn't after the median time %d of the previous blocks", block.Timestamp, medianTime)
+	}
+
+	if block.Timestamp > now.Add(maxDrift).Unix() {
+		return fmt.Errorf("block timestamp %d is more than %s ahead of the current time", block.Timestamp, maxDrift)
+	}
+
+	return nil
+}
+
+// checkBlockTransactions performs the checks of the block transactions that
+// don't depend on the chain state
+func checkBlockTransactions(block *Block) error {
+	if len(block.Transactions) == 0 {
+		return errors.New("block has no transactions")
+	}
+
+	if bytes.Compare(block.TxRoot, block.HashTransactions()) != 0 {
+		return errors.New("transactions root doesn't match the transactions")
+	}
+
+	seen := make(map[string]bool)
+
+	for i, tx := range block.Transactions {
+		txID := hex.EncodeToString(tx.ID)
+
+		err := checkTransaction(tx)
+		if err != nil {
+			return err
+		}
+
+		if seen[txID] {
+			return fmt.Errorf("transaction %x is included twice", tx.ID)
+		}
+		seen[txID] = true
+
+		if tx.IsCoinbase() && i != 0 {
+			return fmt.Errorf("coinbase transaction %x is not the first transaction", tx.ID)
+		}
+	}
+
+	return nil
+}
+
+// checkTransaction performs the checks of a transaction that don't depend on
+// the chain state
+func checkTransaction(tx *Transaction) error {
+	if bytes.Compare(tx.ID, tx.UnsignedHash()) != 0 {
+		return fmt.Errorf("transaction %x doesn't match its hash", tx.ID)
+	}
+
+	if len(tx.Vin) == 0 || len(tx.Vout) == 0 {
+		return fmt.Errorf("transaction %x has no inputs or no outputs", tx.ID)
+	}
+
+	for _, out := range tx.Vout {
+		if out.Value < 0 {
+			return fmt.Errorf("transaction %x has a negative output", tx.ID)
+		}
+	}
+
+	if tx.LockTime < 0 || tx.LockTime > math.MaxUint32 {
+		return fmt.Errorf("transaction %x has a lock time out of range", tx.ID)
+	}
+
+	if tx.Version == legacyTxVersion {
+		err := checkLegacyScripts(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, vin := range tx.Vin {
+		if len(vin.ScriptSig) > maxScriptSize {
+			return fmt.Errorf("transaction %x has an unlocking script longer than %d bytes", tx.ID, maxScriptSize)
+		}
+	}
+
+	for _, out := range tx.Vout {
+		if len(out.ScriptPubKey) > maxScriptSize {
+			return fmt.Errorf("transaction %x has a locking script longer than %d bytes", tx.ID, maxScriptSize)
+		}
+	}
+
+	return nil
+}
+
+// checkLegacyScripts checks that a legacy transaction holds nothing its gob
+// based hash doesn't commit to: pay-to-pubkey-hash scripts and no lock time
+func checkLegacyScripts(tx *Transaction) error {
+	if tx.LockTime != 0 {
+		return fmt.Errorf("legacy transaction %x has a lock time", tx.ID)
+	}
+
+	for _, vin := range tx.Vin {
+		if _, _, ok := extractP2PKHUnlocking(vin.ScriptSig); !ok {
+			return fmt.Errorf("transaction %x: %s", tx.ID, errP2PKHOnly)
+		}
+	}
+
+	for _, out := range tx.Vout {
+		if _, ok := extractP2PKH(out.ScriptPubKey); !ok {
+			return fmt.Errorf("transaction %x: %s", tx.ID, errP2PKHOnly)
+		}
+	}
+
+	return nil
+}
+
+// checkFinalTransactions checks that the transactions of a block are final at
+// its height, given the median time past of its parent
+func checkFinalTransactions(block *Block, medianTime int64) error {
+	for _, tx := range block.Transactions {
+		if !tx.IsFinal(block.Height, medianTime) {
+			return fmt.Errorf("transaction %x is locked until %s", tx.ID, lockTimeString(tx.LockTime))
+		}
+	}
+
+	return nil
+}
+
+// checkCoinbaseValue checks that the coinbase transaction of a block, if any,
+// pays no more than the subsidy of the block plus the fees of its transactions
+func checkCoinbaseValue(block *Block, fees int) error {
+	coinbase := block.Transactions[0]
+	if !coinbase.IsCoinbase() {
+		return nil
+	}
+
+	subsidy := activeParams.Emission.Subsidy(block.Height)
+	if value := coinbase.OutputValue(); value > subsidy+fees {
+		return fmt.Errorf("coinbase transaction %x pays %d, more than the subsidy of %d plus %d of fees", coinbase.ID, value, subsidy, fees)
+	}
+
+	return nil
+}
+
+// checkTransactionSignatures executes the scripts of the inputs of a
+// transaction against the outputs it spends, given in the order of its inputs.
+// Only the spent outputs are needed, so it works when the blocks holding them
+// are pruned.
+func checkTransactionSignatures(btx *Transaction, spent []TXOutput) error {
+	if btx.IsCoinbase() {
+		return nil
+	}
+
+	err := btx.verifyInputs(prevTXsFromOutputs(btx, spent))
+	if err != nil {
+		return fmt.Errorf("transaction %x has an invalid input, %s", btx.ID, err)
+	}
+
+	return nil
+}
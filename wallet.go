@@ -6,12 +6,13 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"fmt"
 	"log"
+	"math/big"
 
 	"golang.org/x/crypto/ripemd160"
 )
 
-const version = byte(0x00)
 const walletFile = "wallet.dat"
 const addressChecksumLen = 4
 
@@ -31,9 +32,22 @@ func NewWallet() *Wallet {
 
 // GetAddress returns wallet address
 func (w Wallet) GetAddress() []byte {
-	pubKeyHash := HashPubKey(w.PublicKey)
+	return encodeAddress(HashPubKey(w.PublicKey))
+}
+
+// encodeAddress returns the address of a public key hash on the active network
+func encodeAddress(pubKeyHash []byte) []byte {
+	return encodeVersionedAddress(activeParams.AddressVersion, pubKeyHash)
+}
 
-	versionedPayload := append([]byte{version}, pubKeyHash...)
+// encodeScriptAddress returns the address of a script hash on the active network
+func encodeScriptAddress(scriptHash []byte) []byte {
+	return encodeVersionedAddress(activeParams.ScriptAddressVersion, scriptHash)
+}
+
+// encodeVersionedAddress returns the address of a hash with a version byte
+func encodeVersionedAddress(version byte, hash []byte) []byte {
+	versionedPayload := append([]byte{version}, hash...)
 	checksum := checksum(versionedPayload)
 
 	fullPayload := append(versionedPayload, checksum...)
@@ -56,17 +70,37 @@ func HashPubKey(pubKey []byte) []byte {
 	return publicRIPEMD160
 }
 
-// ValidateAddress check if address if valid
+// ValidateAddress check if address if valid on the active network
 func ValidateAddress(address string) bool {
 	pubKeyHash := Base58Decode([]byte(address))
+	if len(pubKeyHash) <= addressChecksumLen {
+		return false
+	}
 	actualChecksum := pubKeyHash[len(pubKeyHash)-addressChecksumLen:]
 	version := pubKeyHash[0]
+	if version != activeParams.AddressVersion && version != activeParams.ScriptAddressVersion {
+		return false
+	}
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-addressChecksumLen]
 	targetChecksum := checksum(append([]byte{version}, pubKeyHash...))
 
 	return bytes.Compare(actualChecksum, targetChecksum) == 0
 }
 
+// AddressScript returns the locking script paying to a valid address: a
+// pay-to-pubkey-hash script for a wallet address, a pay-to-script-hash script
+// for a script address
+func AddressScript(address string) []byte {
+	payload := Base58Decode([]byte(address))
+	hash := payload[1 : len(payload)-addressChecksumLen]
+
+	if payload[0] == activeParams.ScriptAddressVersion {
+		return NewP2SHScript(hash)
+	}
+
+	return NewP2PKHScript(hash)
+}
+
 // Checksum generates a checksum for a public key
 func checksum(payload []byte) []byte {
 	firstSHA := sha256.Sum256(payload)
@@ -81,7 +115,33 @@ func newKeyPair() (ecdsa.PrivateKey, []byte) {
 	if err != nil {
 		log.Panic(err)
 	}
-	pubKey := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
+	pubKey := pubKeyBytes(&private.PublicKey)
 
 	return *private, pubKey
 }
+
+// pubKeyLen is the length of a public key with fixed-width coordinates
+const pubKeyLen = 64
+
+// pubKeyBytes returns the public key as wallets store it and transactions and
+// blocks carry it, its coordinates zero-padded to 32 bytes each so it can be
+// split in half whatever their values
+func pubKeyBytes(pubKey *ecdsa.PublicKey) []byte {
+	key := make([]byte, pubKeyLen)
+	pubKey.X.FillBytes(key[:pubKeyLen/2])
+	pubKey.Y.FillBytes(key[pubKeyLen/2:])
+
+	return key
+}
+
+// parsePubKey parses a public key with fixed-width coordinates
+func parsePubKey(key []byte) (*ecdsa.PublicKey, error) {
+	if len(key) != pubKeyLen {
+		return nil, fmt.Errorf("public key is %d bytes long instead of %d", len(key), pubKeyLen)
+	}
+
+	x := new(big.Int).SetBytes(key[:pubKeyLen/2])
+	y := new(big.Int).SetBytes(key[pubKeyLen/2:])
+
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
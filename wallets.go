@@ -10,17 +10,20 @@ import (
 	"os"
 )
 
-// Wallets stores a collection of wallets
+// Wallets stores a collection of wallets and the redeem scripts of the
+// script addresses the wallets take part in, by address
 type Wallets struct {
 	Wallets map[string]*Wallet
+	Scripts map[string][]byte
 }
 
 // NewWallets creates Wallets and fills it from a file if it exists
-func NewWallets() (*Wallets, error) {
+func NewWallets(walletPath string) (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.Scripts = make(map[string][]byte)
 
-	err := wallets.LoadFromFile()
+	err := wallets.LoadFromFile(walletPath)
 
 	return &wallets, err
 }
@@ -35,6 +38,15 @@ func (ws *Wallets) CreateWallet() string {
 	return address
 }
 
+// AddScript adds a redeem script to Wallets and returns its address
+func (ws *Wallets) AddScript(redeemScript []byte) string {
+	address := string(encodeScriptAddress(HashPubKey(redeemScript)))
+
+	ws.Scripts[address] = redeemScript
+
+	return address
+}
+
 // GetAddresses returns an array of addresses stored in the wallet file
 func (ws *Wallets) GetAddresses() []string {
 	var addresses []string
@@ -52,12 +64,12 @@ func (ws Wallets) GetWallet(address string) Wallet {
 }
 
 // LoadFromFile loads wallets from the file
-func (ws *Wallets) LoadFromFile() error {
-	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
+func (ws *Wallets) LoadFromFile(walletPath string) error {
+	if _, err := os.Stat(walletPath); os.IsNotExist(err) {
 		return err
 	}
 
-	fileContent, err := ioutil.ReadFile(walletFile)
+	fileContent, err := ioutil.ReadFile(walletPath)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -71,12 +83,15 @@ func (ws *Wallets) LoadFromFile() error {
 	}
 
 	ws.Wallets = wallets.Wallets
+	if wallets.Scripts != nil {
+		ws.Scripts = wallets.Scripts
+	}
 
 	return nil
 }
 
 // SaveToFile saves wallets to a file
-func (ws Wallets) SaveToFile() {
+func (ws Wallets) SaveToFile(walletPath string) {
 	var content bytes.Buffer
 
 	gob.Register(elliptic.P256())
@@ -87,7 +102,7 @@ func (ws Wallets) SaveToFile() {
 		log.Panic(err)
 	}
 
-	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
+	err = ioutil.WriteFile(walletPath, content.Bytes(), 0644)
 	if err != nil {
 		log.Panic(err)
 	}